@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/gorilla/mux"
+)
+
+type AdminUser struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	FirebaseUID string     `json:"firebaseUid,omitempty"`
+	InvitedBy   string     `json:"invitedBy,omitempty"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+	RevokedAt   *time.Time `json:"revokedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+const adminUserColumns = "id, email, role, COALESCE(firebase_uid, ''), COALESCE(invited_by, ''), last_login_at, revoked_at, created_at, updated_at"
+
+func scanAdminUser(row rowScanner) (AdminUser, error) {
+	var u AdminUser
+	var lastLogin, revoked sql.NullTime
+	err := row.Scan(&u.ID, &u.Email, &u.Role, &u.FirebaseUID, &u.InvitedBy, &lastLogin, &revoked, &u.CreatedAt, &u.UpdatedAt)
+	if lastLogin.Valid {
+		u.LastLoginAt = &lastLogin.Time
+	}
+	if revoked.Valid {
+		u.RevokedAt = &revoked.Time
+	}
+	return u, err
+}
+
+// getCurrentAdmin tells the admin UI who is signed in and what they may do
+func (s *Server) getCurrentAdmin(w http.ResponseWriter, r *http.Request) {
+	role := requestRole(r)
+	email, _ := r.Context().Value("email").(string)
+	userID, _ := r.Context().Value("userID").(string)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uid":         userID,
+		"email":       email,
+		"role":        role,
+		"permissions": rolePermissions[role],
+	})
+}
+
+func (s *Server) getAdminUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT " + adminUserColumns + " FROM admin_users ORDER BY revoked_at IS NOT NULL, created_at")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		users = append(users, u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// inviteAdminUser grants a role to an email address. Inviting a revoked user restores access.
+func (s *Server) inviteAdminUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(body.Email))
+	errs := FieldErrors{}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		errs.add("email", "must be a valid email address")
+	}
+	errs.oneOf("role", body.Role, RoleOwner, RoleEditor, RoleAuthor, RoleViewer)
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	invitedBy, _ := r.Context().Value("email").(string)
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var before map[string]interface{}
+	var existingID string
+	err = tx.QueryRow("SELECT id FROM admin_users WHERE email=$1", email).Scan(&existingID)
+	if err == nil {
+		// Re-inviting an existing user changes their role, so the last owner stays protected
+		if body.Role != RoleOwner {
+			if last, err := isLastOwner(tx, existingID); err != nil {
+				writeInternalError(w, err)
+				return
+			} else if last {
+				writeError(w, http.StatusConflict, "The last owner cannot be demoted")
+				return
+			}
+		}
+		if before, err = snapshotRow(tx, "admin_users", existingID); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	} else if err != sql.ErrNoRows {
+		writeInternalError(w, err)
+		return
+	}
+
+	u, err := scanAdminUser(tx.QueryRow(
+		`INSERT INTO admin_users (email, role, invited_by) VALUES ($1, $2, $3)
+		ON CONFLICT (email) DO UPDATE SET role=EXCLUDED.role, invited_by=EXCLUDED.invited_by, revoked_at=NULL, updated_at=CURRENT_TIMESTAMP
+		RETURNING `+adminUserColumns,
+		email, body.Role, invitedBy,
+	))
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	action := "invite"
+	if before != nil {
+		action = "update"
+	}
+	if err := auditRowChange(tx, r, "admin_user", "admin_users", u.ID, action, before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	invalidateRoleCache()
+	s.syncRoleClaim(r.Context(), u.Email, u.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(u)
+}
+
+func (s *Server) updateAdminUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	errs := FieldErrors{}
+	errs.oneOf("role", body.Role, RoleOwner, RoleEditor, RoleAuthor, RoleViewer)
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if body.Role != RoleOwner {
+		if last, err := isLastOwner(tx, id); err != nil {
+			writeInternalError(w, err)
+			return
+		} else if last {
+			writeError(w, http.StatusConflict, "The last owner cannot be demoted")
+			return
+		}
+	}
+
+	before, err := snapshotRow(tx, "admin_users", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	u, err := scanAdminUser(tx.QueryRow(
+		"UPDATE admin_users SET role=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 RETURNING "+adminUserColumns,
+		body.Role, id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "User not found")
+		} else {
+			writeInternalError(w, err)
+		}
+		return
+	}
+
+	if err := auditRowChange(tx, r, "admin_user", "admin_users", id, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	invalidateRoleCache()
+	if u.RevokedAt == nil {
+		s.syncRoleClaim(r.Context(), u.Email, u.Role)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// revokeAdminUser removes a user's access. The row is kept so the access history stays visible.
+func (s *Server) revokeAdminUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if last, err := isLastOwner(tx, id); err != nil {
+		writeInternalError(w, err)
+		return
+	} else if last {
+		writeError(w, http.StatusConflict, "The last owner cannot be revoked")
+		return
+	}
+
+	before, err := snapshotRow(tx, "admin_users", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var email string
+	err = tx.QueryRow(
+		"UPDATE admin_users SET revoked_at=COALESCE(revoked_at, CURRENT_TIMESTAMP), updated_at=CURRENT_TIMESTAMP WHERE id=$1 RETURNING email",
+		id,
+	).Scan(&email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "User not found")
+		} else {
+			writeInternalError(w, err)
+		}
+		return
+	}
+
+	if err := auditRowChange(tx, r, "admin_user", "admin_users", id, "revoke", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	invalidateRoleCache()
+	s.syncRoleClaim(r.Context(), email, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isLastOwner reports whether id is the only owner with access. It locks the owner rows
+// until tx ends, so concurrent demotions and revocations can't each leave the other last.
+func isLastOwner(tx *sql.Tx, id string) (bool, error) {
+	rows, err := tx.Query("SELECT id FROM admin_users WHERE role='owner' AND revoked_at IS NULL FOR UPDATE")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	owners, isOwner := 0, false
+	for rows.Next() {
+		var ownerID string
+		if err := rows.Scan(&ownerID); err != nil {
+			return false, err
+		}
+		owners++
+		isOwner = isOwner || strings.EqualFold(ownerID, id)
+	}
+	return isOwner && owners <= 1, rows.Err()
+}
+
+// syncRoleClaim mirrors a role change into the user's Firebase custom claims and, on
+// revocation, signs them out everywhere. Users who have never signed in have no Firebase
+// account yet; they are linked on their first request instead.
+func (s *Server) syncRoleClaim(ctx context.Context, email, role string) {
+	user, err := s.authClient.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !auth.IsUserNotFound(err) {
+			log.Printf("Error looking up Firebase user %s: %v", email, err)
+		}
+		return
+	}
+
+	claims := map[string]interface{}{}
+	for k, v := range user.CustomClaims {
+		claims[k] = v
+	}
+	if role == "" {
+		delete(claims, "role")
+	} else {
+		claims["role"] = role
+	}
+
+	if err := s.authClient.SetCustomUserClaims(ctx, user.UID, claims); err != nil {
+		log.Printf("Error setting custom claims for %s: %v", email, err)
+	}
+	if role == "" {
+		if err := s.authClient.RevokeRefreshTokens(ctx, user.UID); err != nil {
+			log.Printf("Error revoking sessions of %s: %v", email, err)
+		}
+	}
+}
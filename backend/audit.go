@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns that change on every write or are derived, so they would only add noise
+var auditIgnoredFields = map[string]bool{
+	"created_at":    true,
+	"updated_at":    true,
+	"search_vector": true,
+	"category_type": true,
+}
+
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type AuditEntry struct {
+	ID         string                 `json:"id"`
+	ActorUID   string                 `json:"actorUid,omitempty"`
+	ActorEmail string                 `json:"actorEmail,omitempty"`
+	EntityType string                 `json:"entityType"`
+	EntityID   string                 `json:"entityId,omitempty"`
+	Action     string                 `json:"action"`
+	Changes    map[string]FieldChange `json:"changes"`
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// snapshotRow returns a row as a JSON object, or nil when it does not exist
+func snapshotRow(tx *sql.Tx, table, id string) (map[string]interface{}, error) {
+	var raw []byte
+	err := tx.QueryRow("SELECT to_jsonb(t) FROM "+table+" t WHERE id::text=$1", id).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// snapshotOrder returns the ids of a sortable table in display order
+func snapshotOrder(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("SELECT id FROM " + table + " ORDER BY sort_order ASC, created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// diffRows lists the fields that differ between two snapshots. A nil snapshot stands
+// for a row that did not exist, so creations and deletions list every field.
+func diffRows(before, after map[string]interface{}) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	for k, v := range before {
+		if auditIgnoredFields[k] {
+			continue
+		}
+		if !reflect.DeepEqual(v, after[k]) {
+			changes[k] = FieldChange{From: v, To: after[k]}
+		}
+	}
+	for k, v := range after {
+		if auditIgnoredFields[k] {
+			continue
+		}
+		if _, ok := before[k]; !ok {
+			changes[k] = FieldChange{From: nil, To: v}
+		}
+	}
+	return changes
+}
+
+// recordAudit logs a change of one row within the transaction making it. Updates that
+// changed nothing are not recorded.
+func recordAudit(tx *sql.Tx, r *http.Request, entityType, entityID, action string, before, after map[string]interface{}) error {
+	if before == nil && after == nil {
+		return nil
+	}
+	changes := diffRows(before, after)
+	if len(changes) == 0 && action == "update" {
+		return nil
+	}
+	return insertAudit(tx, r, entityType, entityID, action, changes)
+}
+
+// auditRowChange snapshots the row after a write and logs how it differs from before
+func auditRowChange(tx *sql.Tx, r *http.Request, entityType, table, id, action string, before map[string]interface{}) error {
+	after, err := snapshotRow(tx, table, id)
+	if err != nil {
+		return err
+	}
+	return recordAudit(tx, r, entityType, id, action, before, after)
+}
+
+// auditReorder logs a new display order of a sortable table
+func auditReorder(tx *sql.Tx, r *http.Request, entityType string, before, after []string) error {
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return insertAudit(tx, r, entityType, "", "reorder", map[string]FieldChange{
+		"order": {From: before, To: after},
+	})
+}
+
+// requestActor returns who made a request. A nil request stands for the server itself,
+// e.g. the scheduled publisher, which has no actor.
+func requestActor(r *http.Request) (userID, email string) {
+	if r == nil {
+		return "", ""
+	}
+	userID, _ = r.Context().Value("userID").(string)
+	email, _ = r.Context().Value("email").(string)
+	return userID, email
+}
+
+func insertAudit(tx *sql.Tx, r *http.Request, entityType, entityID, action string, changes map[string]FieldChange) error {
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	userID, email := requestActor(r)
+	_, err = tx.Exec(
+		"INSERT INTO audit_log (actor_uid, actor_email, entity_type, entity_id, action, changes) VALUES (NULLIF($1, ''), NULLIF($2, ''), $3, NULLIF($4, ''), $5, $6)",
+		userID, email, entityType, entityID, action, raw,
+	)
+	return err
+}
+
+// getAuditLog lists audit entries, newest first. Filters: user (UID or email),
+// entityType, entityId, action, from and to (RFC 3339 or YYYY-MM-DD).
+func (s *Server) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, limit := 1, 50
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid page")
+			return
+		}
+		page = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	var args sqlArgs
+	conds := []string{"TRUE"}
+	if v := q.Get("user"); v != "" {
+		p := args.add(v)
+		conds = append(conds, "(actor_uid = "+p+" OR actor_email = lower("+p+"))")
+	}
+	if v := q.Get("entityType"); v != "" {
+		conds = append(conds, "entity_type = "+args.add(v))
+	}
+	if v := q.Get("entityId"); v != "" {
+		conds = append(conds, "entity_id = "+args.add(v))
+	}
+	if v := q.Get("action"); v != "" {
+		conds = append(conds, "action = "+args.add(v))
+	}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<="}} {
+		v := q.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := parseAuditTime(v, bound.param == "to")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid "+bound.param+": use RFC 3339 or YYYY-MM-DD")
+			return
+		}
+		conds = append(conds, "created_at "+bound.op+" "+args.add(t))
+	}
+	where := strings.Join(conds, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE "+where, args...).Scan(&total); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	query := "SELECT id, COALESCE(actor_uid, ''), COALESCE(actor_email, ''), entity_type, COALESCE(entity_id, ''), action, changes, created_at FROM audit_log WHERE " +
+		where + " ORDER BY created_at DESC, id DESC LIMIT " + args.add(limit) + " OFFSET " + args.add((page-1)*limit)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var raw []byte
+		if err := rows.Scan(&e.ID, &e.ActorUID, &e.ActorEmail, &e.EntityType, &e.EntityID, &e.Action, &raw, &e.CreatedAt); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if err := json.Unmarshal(raw, &e.Changes); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		items = append(items, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// parseAuditTime accepts a timestamp or a date; a date used as an upper bound covers the whole day
+func parseAuditTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CategoryRef is the category embedded in articles and courses
+type CategoryRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// categoryContent describes the content filed under categories of one type
+type categoryContent struct {
+	table      string
+	entityType string
+	label      string
+}
+
+var categoryContents = map[string]categoryContent{
+	"blog":   {table: "articles", entityType: "article", label: "articles"},
+	"course": {table: "courses", entityType: "course", label: "courses"},
+}
+
+func categoryRef(id, name, categoryType string) *CategoryRef {
+	if id == "" {
+		return nil
+	}
+	return &CategoryRef{ID: id, Name: name, Type: categoryType}
+}
+
+// resolveCategory points an article or course at a live category of categoryType. A
+// categoryId wins over a name; a name that is a UUID is taken as an id, which is how the
+// admin used to store course categories. On success id and name hold the category's id
+// and current name; problems are added to errs.
+func resolveCategory(tx *sql.Tx, categoryType string, id, name *string, errs FieldErrors) error {
+	field, value := "categoryId", *id
+	if value == "" {
+		field, value = "category", strings.TrimSpace(*name)
+	}
+	if value == "" {
+		*id, *name = "", ""
+		return nil
+	}
+
+	var catID, catName, catType string
+	var err error
+	if isUUID(value) {
+		err = tx.QueryRow("SELECT id, name, type FROM categories WHERE id=$1 AND deleted_at IS NULL", value).Scan(&catID, &catName, &catType)
+	} else {
+		err = tx.QueryRow(
+			"SELECT id, name, type FROM categories WHERE lower(name)=lower($1) AND type=$2 AND deleted_at IS NULL ORDER BY sort_order, created_at LIMIT 1",
+			value, categoryType,
+		).Scan(&catID, &catName, &catType)
+	}
+	if err == sql.ErrNoRows {
+		errs.add(field, "is not an existing "+categoryType+" category")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if catType != categoryType {
+		errs.add(field, "must be a "+categoryType+" category")
+		return nil
+	}
+
+	*id, *name = catID, catName
+	return nil
+}
+
+// categoryNameTaken reports whether another live category of the same type has this name
+func categoryNameTaken(tx *sql.Tx, name, categoryType, exceptID string) (bool, error) {
+	var taken bool
+	err := tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM categories WHERE lower(name)=lower($1) AND type=$2 AND id::text<>$3 AND deleted_at IS NULL)",
+		name, categoryType, exceptID,
+	).Scan(&taken)
+	return taken, err
+}
+
+// countCategoryUse counts the content filed under a category. Trashed content is only
+// counted with includeTrashed, since it still holds the reference.
+func countCategoryUse(tx *sql.Tx, categoryType, id string, includeTrashed bool) (int, error) {
+	query := "SELECT COUNT(*) FROM " + categoryContents[categoryType].table + " WHERE category_id=$1"
+	if !includeTrashed {
+		query += " AND deleted_at IS NULL"
+	}
+	var n int
+	err := tx.QueryRow(query, id).Scan(&n)
+	return n, err
+}
+
+// reassignCategory moves all content, trashed content included, from one category to
+// another and records the change of every moved item in the audit log
+func reassignCategory(tx *sql.Tx, r *http.Request, categoryType, fromID, fromName, toID, toName string) error {
+	c := categoryContents[categoryType]
+	rows, err := tx.Query("UPDATE "+c.table+" SET category_id=$1, category=$2, updated_at=CURRENT_TIMESTAMP WHERE category_id=$3 RETURNING id", toID, toName, fromID)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := insertAudit(tx, r, c.entityType, id, "update", map[string]FieldChange{
+			"category_id": {From: fromID, To: toID},
+			"category":    {From: fromName, To: toName},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoryInUseMessage explains why a category cannot be deleted or change type
+func categoryInUseMessage(categoryType string, n int, action string) string {
+	return fmt.Sprintf("Category is used by %d %s; %s", n, categoryContents[categoryType].label, action)
+}
@@ -17,10 +17,27 @@ type ContactRequest struct {
 	CreatedAt int64  `json:"createdAt"`
 }
 
+// contactAddress is where contact messages go and where replies to site emails land
+func contactAddress() string {
+	if to := os.Getenv("CONTACT_TO"); to != "" {
+		return to
+	}
+	return "devitska.education@gmail.com" // Default fallback
+}
+
+// contactAutoReply reports whether senders get a confirmation email, which is opt-in with
+// CONTACT_AUTOREPLY=true: anyone can type someone else's address into the form
+func contactAutoReply() bool {
+	return os.Getenv("CONTACT_AUTOREPLY") == "true"
+}
+
+// autoReplyInterval is how often one address gets a confirmation at most
+const autoReplyInterval = 24 * time.Hour
+
 func (s *Server) handleContact(w http.ResponseWriter, r *http.Request) {
 	var req ContactRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
@@ -39,40 +56,89 @@ func (s *Server) handleContact(w http.ResponseWriter, r *http.Request) {
 	// 2. Timing check (too fast = bot)
 	if time.Now().UnixMilli()-req.CreatedAt < 2000 {
 		log.Printf("Bot suspected (too fast): %s", req.Email)
-		http.Error(w, "Too fast. Please wait a moment.", http.StatusTooManyRequests)
+		writeError(w, http.StatusTooManyRequests, "Too fast. Please wait a moment.")
 		return
 	}
 
 	// 3. Basic validation
 	if req.Name == "" || req.Email == "" || req.Message == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
-
-	// 4. Send Email
-	to := os.Getenv("CONTACT_TO")
-	if to == "" {
-		to = "devitska.education@gmail.com" // Default fallback
+	if errs := validateContact(&req); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
 	}
 
-	subject := "New Contact Form Message: " + req.Subject
-	if req.Subject == "" {
-		subject = "New Contact Form Message from " + req.Name
+	// 4. Store the message and queue the notification in one transaction, so the message
+	// reaches the admin inbox even when email is down and the response never waits on SMTP
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
 	}
+	defer tx.Rollback()
 
-	body := "Name: " + req.Name + "\n" +
-		"Email: " + req.Email + "\n" +
-		"Subject: " + req.Subject + "\n\n" +
-		"Message:\n" + req.Message
+	var id string
+	err = tx.QueryRow(
+		"INSERT INTO contact_messages (name, email, subject, message) VALUES ($1, $2, $3, $4) RETURNING id",
+		req.Name, req.Email, req.Subject, req.Message,
+	).Scan(&id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 
-	err := sendEmail(to, subject, body, req.Email)
+	// 5. Queue the notification and the confirmation to the sender
+	data := map[string]interface{}{"Name": req.Name, "Email": req.Email, "Subject": req.Subject, "Message": req.Message}
+	notification, err := renderEmail("contact_notification", defaultLocale(), data)
 	if err != nil {
-		log.Printf("Error sending email: %v", err)
-		http.Error(w, "Failed to send message. Please try again later.", http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	notification.To, notification.ReplyTo, notification.ContactMessageID = contactAddress(), req.Email, id
+	if err := queueEmail(tx, notification); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if contactAutoReply() {
+		// The reply holds nothing from the form, so it can't carry someone's text to others
+		reply, err := renderEmail("contact_autoreply", locale, map[string]interface{}{})
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		reply.To, reply.ReplyTo = req.Email, contactAddress()
+
+		var recent bool
+		err = tx.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM email_outbox WHERE template=$1 AND lower(recipient)=lower($2) AND created_at > $3)",
+			reply.Template, reply.To, time.Now().Add(-autoReplyInterval),
+		).Scan(&recent)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if !recent {
+			if err := queueEmail(tx, reply); err != nil {
+				writeInternalError(w, err)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
+	wakeOutbox()
 
-	// 5. Success response
+	// 6. Success response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
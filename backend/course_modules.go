@@ -0,0 +1,590 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type CourseModule struct {
+	ID           string         `json:"id"`
+	CourseID     string         `json:"courseId"`
+	Title        string         `json:"title"`
+	SortOrder    int            `json:"sortOrder"`
+	LessonCount  int            `json:"lessonCount"`
+	TotalMinutes int            `json:"totalMinutes"`
+	Lessons      []CourseLesson `json:"lessons"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+}
+
+type CourseLesson struct {
+	ID              string    `json:"id"`
+	ModuleID        string    `json:"moduleId"`
+	Title           string    `json:"title"`
+	DurationMinutes int       `json:"durationMinutes"`
+	Preview         bool      `json:"preview"` // open to visitors who have not enrolled
+	SortOrder       int       `json:"sortOrder"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// applyTotals replaces the free-text lessons and duration with the totals of the course's
+// lessons, once it has any
+func (c *Course) applyTotals(locale string) {
+	if c.LessonCount == 0 {
+		return
+	}
+	c.Lessons = lessonCountText(locale, c.LessonCount)
+	if c.TotalMinutes > 0 {
+		c.Duration = durationText(locale, c.TotalMinutes)
+	}
+}
+
+func lessonCountText(locale string, n int) string {
+	if locale == "uk" {
+		return fmt.Sprintf("%d %s", n, ukrainianPlural(n, "урок", "уроки", "уроків"))
+	}
+	if n == 1 {
+		return "1 lesson"
+	}
+	return fmt.Sprintf("%d lessons", n)
+}
+
+// durationText writes minutes as hours and minutes, e.g. "2 h 30 min" or "2 год 30 хв"
+func durationText(locale string, minutes int) string {
+	hour, min := "h", "min"
+	if locale == "uk" {
+		hour, min = "год", "хв"
+	}
+	h, m := minutes/60, minutes%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%d %s", m, min)
+	case m == 0:
+		return fmt.Sprintf("%d %s", h, hour)
+	}
+	return fmt.Sprintf("%d %s %d %s", h, hour, m, min)
+}
+
+// ukrainianPlural picks the form for 1 (and 21, 31...), for 2-4 (and 22-24...) and for the rest
+func ukrainianPlural(n int, one, few, many string) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return one
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return few
+	}
+	return many
+}
+
+// loadCourseModules returns the modules of a course in order, each with its lessons
+func loadCourseModules(courseID string) ([]CourseModule, error) {
+	rows, err := db.Query("SELECT id, course_id, title, sort_order, created_at, updated_at FROM course_modules WHERE course_id=$1 ORDER BY sort_order ASC, created_at ASC", courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modules := []CourseModule{}
+	index := map[string]int{}
+	for rows.Next() {
+		m := CourseModule{Lessons: []CourseLesson{}}
+		if err := rows.Scan(&m.ID, &m.CourseID, &m.Title, &m.SortOrder, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		index[m.ID] = len(modules)
+		modules = append(modules, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lessonRows, err := db.Query(`
+		SELECT l.id, l.module_id, l.title, l.duration_minutes, l.preview, l.sort_order, l.created_at, l.updated_at
+		FROM course_lessons l JOIN course_modules m ON m.id = l.module_id
+		WHERE m.course_id=$1 ORDER BY l.sort_order ASC, l.created_at ASC`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer lessonRows.Close()
+
+	for lessonRows.Next() {
+		var l CourseLesson
+		if err := lessonRows.Scan(&l.ID, &l.ModuleID, &l.Title, &l.DurationMinutes, &l.Preview, &l.SortOrder, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		m := &modules[index[l.ModuleID]]
+		m.Lessons = append(m.Lessons, l)
+		m.LessonCount++
+		m.TotalMinutes += l.DurationMinutes
+	}
+	return modules, lessonRows.Err()
+}
+
+// findCourse checks that a course exists and is not in the trash, answering 404 otherwise
+func findCourse(w http.ResponseWriter, tx *sql.Tx, id string) bool {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM courses WHERE id=$1 AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		writeInternalError(w, err)
+		return false
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "Course not found")
+		return false
+	}
+	return true
+}
+
+// findModule checks that a module belongs to the course, answering 404 otherwise
+func findModule(w http.ResponseWriter, tx *sql.Tx, courseID, moduleID string) bool {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM course_modules WHERE id=$1 AND course_id=$2)", moduleID, courseID).Scan(&exists); err != nil {
+		writeInternalError(w, err)
+		return false
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "Module not found")
+		return false
+	}
+	return true
+}
+
+// snapshotCourseOrder returns the ids of a course's modules, or of a module's lessons, in order
+func snapshotCourseOrder(tx *sql.Tx, table, fk, id string) ([]string, error) {
+	rows, err := tx.Query("SELECT id FROM "+table+" WHERE "+fk+"=$1 ORDER BY sort_order ASC, created_at ASC", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Module Handlers
+
+func (s *Server) createCourseModule(w http.ResponseWriter, r *http.Request) {
+	courseID := mux.Vars(r)["id"]
+
+	var m CourseModule
+	if !decodeJSON(w, r, &m) {
+		return
+	}
+	if errs := validateCourseModule(&m); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if !findCourse(w, tx, courseID) {
+		return
+	}
+
+	m.CourseID = courseID
+	m.Lessons = []CourseLesson{}
+	err = tx.QueryRow(
+		"INSERT INTO course_modules (course_id, title, sort_order) VALUES ($1, $2, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM course_modules WHERE course_id=$1)) RETURNING id, sort_order, created_at, updated_at",
+		courseID, m.Title,
+	).Scan(&m.ID, &m.SortOrder, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course_module", "course_modules", m.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m)
+}
+
+func (s *Server) updateCourseModule(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	courseID, moduleID := params["id"], params["moduleId"]
+
+	var m CourseModule
+	if !decodeJSON(w, r, &m) {
+		return
+	}
+	if errs := validateCourseModule(&m); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "course_modules", moduleID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("UPDATE course_modules SET title=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 AND course_id=$3", m.Title, moduleID, courseID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Module not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course_module", "course_modules", moduleID, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteCourseModule deletes a module together with its lessons
+func (s *Server) deleteCourseModule(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	courseID, moduleID := params["id"], params["moduleId"]
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "course_modules", moduleID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("DELETE FROM course_modules WHERE id=$1 AND course_id=$2", moduleID, courseID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Module not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course_module", "course_modules", moduleID, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) reorderCourseModules(w http.ResponseWriter, r *http.Request) {
+	courseID := mux.Vars(r)["id"]
+
+	var moduleIDs []string
+	if !decodeJSON(w, r, &moduleIDs) {
+		return
+	}
+	if errs := validateIDList(moduleIDs); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if !findCourse(w, tx, courseID) {
+		return
+	}
+
+	before, err := snapshotCourseOrder(tx, "course_modules", "course_id", courseID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	for i, id := range moduleIDs {
+		_, err := tx.Exec("UPDATE course_modules SET sort_order = $1 WHERE id = $2 AND course_id = $3", i, id, courseID)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	after, err := snapshotCourseOrder(tx, "course_modules", "course_id", courseID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if err := auditReorder(tx, r, "course_module", before, after); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lesson Handlers
+
+func (s *Server) createCourseLesson(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	courseID, moduleID := params["id"], params["moduleId"]
+
+	var l CourseLesson
+	if !decodeJSON(w, r, &l) {
+		return
+	}
+	l.ModuleID = moduleID
+	if errs := validateCourseLesson(&l); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if !findCourse(w, tx, courseID) || !findModule(w, tx, courseID, moduleID) {
+		return
+	}
+
+	err = tx.QueryRow(
+		"INSERT INTO course_lessons (module_id, title, duration_minutes, preview, sort_order) VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM course_lessons WHERE module_id=$1)) RETURNING id, sort_order, created_at, updated_at",
+		moduleID, l.Title, l.DurationMinutes, l.Preview,
+	).Scan(&l.ID, &l.SortOrder, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course_lesson", "course_lessons", l.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(l)
+}
+
+// updateCourseLesson edits a lesson. A moduleId of another module of the same course
+// moves the lesson to the end of that module.
+func (s *Server) updateCourseLesson(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	courseID, lessonID := params["id"], params["lessonId"]
+
+	var l CourseLesson
+	if !decodeJSON(w, r, &l) {
+		return
+	}
+	if errs := validateCourseLesson(&l); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var currentModule string
+	err = tx.QueryRow(
+		"SELECT l.module_id FROM course_lessons l JOIN course_modules m ON m.id = l.module_id WHERE l.id=$1 AND m.course_id=$2",
+		lessonID, courseID,
+	).Scan(&currentModule)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Lesson not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if l.ModuleID == "" {
+		l.ModuleID = currentModule
+	}
+	if l.ModuleID != currentModule && !findModule(w, tx, courseID, l.ModuleID) {
+		return
+	}
+
+	before, err := snapshotRow(tx, "course_lessons", lessonID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE course_lessons SET title=$1, duration_minutes=$2, preview=$3, module_id=$4,
+			sort_order = CASE WHEN module_id = $4 THEN sort_order ELSE (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM course_lessons WHERE module_id=$4) END,
+			updated_at=CURRENT_TIMESTAMP
+		WHERE id=$5`,
+		l.Title, l.DurationMinutes, l.Preview, l.ModuleID, lessonID,
+	)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course_lesson", "course_lessons", lessonID, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteCourseLesson(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	courseID, lessonID := params["id"], params["lessonId"]
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "course_lessons", lessonID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("DELETE FROM course_lessons l USING course_modules m WHERE l.id=$1 AND m.id = l.module_id AND m.course_id=$2", lessonID, courseID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Lesson not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course_lesson", "course_lessons", lessonID, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) reorderCourseLessons(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	courseID, moduleID := params["id"], params["moduleId"]
+
+	var lessonIDs []string
+	if !decodeJSON(w, r, &lessonIDs) {
+		return
+	}
+	if errs := validateIDList(lessonIDs); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if !findCourse(w, tx, courseID) || !findModule(w, tx, courseID, moduleID) {
+		return
+	}
+
+	before, err := snapshotCourseOrder(tx, "course_lessons", "module_id", moduleID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	for i, id := range lessonIDs {
+		_, err := tx.Exec("UPDATE course_lessons SET sort_order = $1 WHERE id = $2 AND module_id = $3", i, id, moduleID)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	after, err := snapshotCourseOrder(tx, "course_lessons", "module_id", moduleID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if err := auditReorder(tx, r, "course_lesson", before, after); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"os"
@@ -12,6 +13,22 @@ import (
 var db *sql.DB
 
 func initDB() {
+	openDB()
+
+	// Apply pending schema migrations
+	if os.Getenv("MIGRATE_ON_START") == "false" {
+		log.Println("MIGRATE_ON_START=false, skipping schema migrations")
+	} else if err := migrateUp(context.Background()); err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
+
+	// Runs without migrations too, e.g. when they are applied with `server migrate up`
+	if err := seedOwnersFromEnv(); err != nil {
+		log.Fatalf("Error importing ADMIN_EMAILS: %v", err)
+	}
+}
+
+func openDB() {
 	connStr := os.Getenv("DATABASE_URL")
 	if connStr == "" {
 		log.Fatal("DATABASE_URL environment variable is required")
@@ -30,107 +47,56 @@ func initDB() {
 	}
 
 	log.Println("Successfully connected to database")
-
-	// Create tables if they don't exist
-	createTables()
-
-	// Migration: Add sort_order to categories if it doesn't exist
-	_, _ = db.Exec("ALTER TABLE categories ADD COLUMN IF NOT EXISTS sort_order INTEGER DEFAULT 0")
-}
-
-func createTables() {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS categories (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			name TEXT NOT NULL,
-			type TEXT NOT NULL, -- 'blog' or 'course'
-			sort_order INTEGER DEFAULT 0,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS articles (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			title TEXT NOT NULL,
-			excerpt TEXT,
-			content TEXT NOT NULL,
-			author TEXT,
-			date DATE,
-			category TEXT,
-			featured BOOLEAN DEFAULT false,
-			image TEXT,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS courses (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			title TEXT NOT NULL,
-			description TEXT,
-			lessons TEXT,
-			duration TEXT,
-			price TEXT,
-			category TEXT,
-			tags TEXT[], -- array of strings
-			image TEXT,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS projects (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			title TEXT NOT NULL,
-			description TEXT,
-			detail TEXT,
-			link_label TEXT,
-			link_href TEXT,
-			image TEXT,
-			sort_order INTEGER DEFAULT 0,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS certificates (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			title TEXT NOT NULL,
-			issuer TEXT NOT NULL,
-			year TEXT NOT NULL,
-			image TEXT,
-			sort_order INTEGER DEFAULT 0,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-	}
-
-	for _, q := range queries {
-		_, err := db.Exec(q)
-		if err != nil {
-			log.Fatalf("Error creating table: %v", err)
-		}
-	}
 }
 
 type Article struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	Excerpt   string    `json:"excerpt"`
-	Content   string    `json:"content"`
-	Author    string    `json:"author"`
-	Date      string    `json:"date"`
-	Category  string    `json:"category"`
-	Featured  bool      `json:"featured"`
-	Image     string    `json:"image"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          string       `json:"id"`
+	Slug        string       `json:"slug"`
+	Title       string       `json:"title"`
+	Excerpt     string       `json:"excerpt"`
+	Content     string       `json:"content"`
+	Author      string       `json:"author"`
+	Date        string       `json:"date"`
+	Category    string       `json:"category"`
+	CategoryID  string       `json:"categoryId"`
+	CategoryRef *CategoryRef `json:"categoryRef,omitempty"`
+	Featured    bool         `json:"featured"`
+	Image       string       `json:"image"`
+	ImageSet    *ImageSet    `json:"imageSet,omitempty"`
+	Status      string       `json:"status"`
+	PublishAt   *time.Time   `json:"publishAt"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+
+	// Filled in with ?render=html
+	ContentHTML string     `json:"contentHtml,omitempty"`
+	TOC         []TOCEntry `json:"toc,omitempty"`
+	WordCount   int        `json:"wordCount,omitempty"`
+	ReadingTime int        `json:"readingTime,omitempty"`
 }
 
 type Course struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Lessons     string    `json:"lessons"`
-	Duration    string    `json:"duration"`
-	EnrollLink  string    `json:"enrollLink"`
-	Category    string    `json:"category"`
-	Tags        []string  `json:"tags"`
-	Image       string    `json:"image"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	ID             string         `json:"id"`
+	Title          string         `json:"title"`
+	Description    string         `json:"description"`
+	Lessons        string         `json:"lessons"`
+	Duration       string         `json:"duration"`
+	EnrollLink     string         `json:"enrollLink"`
+	Pricing        *CoursePricing `json:"pricing"` // nil when the course shows no price
+	EnrollmentOpen bool           `json:"enrollmentOpen"`
+	Capacity       *int           `json:"capacity"`            // nil means no limit
+	SpotsLeft      *int           `json:"spotsLeft,omitempty"` // set on listings of limited courses
+	LessonCount    int            `json:"lessonCount"`
+	TotalMinutes   int            `json:"totalMinutes"`
+	Modules        []CourseModule `json:"modules,omitempty"` // only on the course detail
+	Category       string         `json:"category"`
+	CategoryID     string         `json:"categoryId"`
+	CategoryRef    *CategoryRef   `json:"categoryRef,omitempty"`
+	Tags           []string       `json:"tags"`
+	Image          string         `json:"image"`
+	ImageSet       *ImageSet      `json:"imageSet,omitempty"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
 }
 
 type Category struct {
@@ -138,6 +104,7 @@ type Category struct {
 	Name      string `json:"name"`
 	Type      string `json:"type"`
 	SortOrder int    `json:"sort_order"`
+	Count     int    `json:"count"` // published articles or live courses filed under it
 }
 
 type Project struct {
@@ -148,6 +115,7 @@ type Project struct {
 	LinkLabel   string    `json:"linkLabel"`
 	LinkHref    string    `json:"linkHref"`
 	Image       string    `json:"image"`
+	ImageSet    *ImageSet `json:"imageSet,omitempty"`
 	SortOrder   int       `json:"sort_order"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
@@ -159,6 +127,7 @@ type Certificate struct {
 	Issuer    string    `json:"issuer"`
 	Year      string    `json:"year"`
 	Image     string    `json:"image"`
+	ImageSet  *ImageSet `json:"imageSet,omitempty"`
 	SortOrder int       `json:"sort_order"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
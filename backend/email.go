@@ -1,45 +1,426 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-func sendEmail(to, subject, body, replyTo string) error {
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-	user := os.Getenv("SMTP_USER")
-	pass := os.Getenv("SMTP_PASS")
+// Email is one outgoing message. From is filled in by the mailer when empty.
+type Email struct {
+	From    string
+	To      string
+	ReplyTo string
+	Subject string
+	Body    string // plain text
+	HTML    string // optional HTML alternative of Body
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(ctx context.Context, e Email) error
+}
+
+// SMTP connection security
+const (
+	SMTPStartTLS    = "starttls" // plain connection upgraded with STARTTLS, usually port 587
+	SMTPImplicitTLS = "tls"      // TLS from the first byte, usually port 465
+	SMTPNoTLS       = "none"     // local relays and test servers only
+)
+
+const smtpTimeout = 30 * time.Second
+
+// newMailerFromEnv selects the mail backend with MAIL_BACKEND (smtp, file or memory)
+func newMailerFromEnv() (Mailer, error) {
 	from := os.Getenv("CONTACT_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
+
+	switch backend := os.Getenv("MAIL_BACKEND"); backend {
+	case "", "smtp":
+		cfg := SMTPConfig{
+			Host: os.Getenv("SMTP_HOST"),
+			Port: os.Getenv("SMTP_PORT"),
+			User: os.Getenv("SMTP_USER"),
+			Pass: os.Getenv("SMTP_PASS"),
+			From: from,
+			TLS:  os.Getenv("SMTP_TLS"),
+		}
+		if cfg.TLS == "" {
+			cfg.TLS = SMTPStartTLS
+			if cfg.Port == "465" {
+				cfg.TLS = SMTPImplicitTLS
+			}
+		}
+		return NewSMTPMailer(cfg)
+
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileMailer(dir, from)
+
+	case "memory":
+		return NewMemoryMailer(from), nil
+
+	default:
+		return nil, fmt.Errorf("unknown MAIL_BACKEND %q (expected smtp, file or memory)", backend)
+	}
+}
+
+// composeEmail builds the raw message: multipart/alternative when there is an HTML body,
+// plain text otherwise. Both parts are UTF-8 in quoted-printable.
+func composeEmail(e Email) ([]byte, error) {
+	var b messageBuilder
+	b.address("From", e.From)
+	b.address("To", e.To)
+	if e.ReplyTo != "" {
+		b.address("Reply-To", e.ReplyTo)
+	}
+	b.text("Subject", e.Subject)
+	b.header("Date", time.Now().Format(time.RFC1123Z))
+	b.header("Message-ID", messageID(e.From))
+	b.header("MIME-Version", "1.0")
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if e.HTML == "" {
+		b.header("Content-Type", `text/plain; charset="UTF-8"`)
+		b.header("Content-Transfer-Encoding", "quoted-printable")
+		b.buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&b.buf, e.Body); err != nil {
+			return nil, err
+		}
+		return b.buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&b.buf)
+	b.header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	b.buf.WriteString("\r\n")
+	// Clients show the last part they understand, so HTML goes last
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", e.Body},
+		{"text/html", e.HTML},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + `; charset="UTF-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.buf.Bytes(), nil
+}
+
+// errInvalidMessage marks an email that can never be sent as it is, e.g. a bad address
+var errInvalidMessage = errors.New("invalid message")
+
+// permanentSendError reports whether retrying can't help: the message is invalid or the
+// server rejected the sender, recipient or message with a 5xx reply
+func permanentSendError(err error) bool {
+	if errors.Is(err, errInvalidMessage) {
+		return true
+	}
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+// messageBuilder writes message headers, keeping the first error. Every value is checked so
+// a line break in user input can't start a new header or add recipients.
+type messageBuilder struct {
+	buf bytes.Buffer
+	err error
+}
+
+// header writes a value built by the server; control characters in it are an error
+func (b *messageBuilder) header(key, value string) {
+	if b.err != nil {
+		return
+	}
+	if hasControlChars(value) {
+		b.err = fmt.Errorf("%w: %s header contains control characters", errInvalidMessage, key)
+		return
+	}
+	b.buf.WriteString(key + ": " + value + "\r\n")
+}
+
+// address writes an email address header. The value must parse with net/mail; it is
+// written back in canonical form with any display name encoded.
+func (b *messageBuilder) address(key, value string) {
+	if b.err != nil {
+		return
+	}
+	addr, err := parseAddress(value)
+	if err != nil {
+		b.err = fmt.Errorf("%w: %s address %q: %v", errInvalidMessage, key, value, err)
+		return
+	}
+	b.header(key, addr.String())
+}
+
+// text writes free text such as the subject. Line breaks and other control characters
+// become spaces and non-ASCII text is RFC 2047 encoded (Cyrillic subjects). Text that looks
+// like an encoded word is encoded too, so clients show it as typed instead of decoding it.
+func (b *messageBuilder) text(key, value string) {
+	value = strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return unsafeHeaderRune(r) || r == ' '
+	}), " ")
+	encoded := mime.BEncoding.Encode("UTF-8", value)
+	if encoded == value && strings.Contains(value, "=?") {
+		encoded = encodeWords(value)
+	}
+	b.header(key, encoded)
+}
+
+// encodeWords B-encodes s as UTF-8 encoded words short enough for one header line each
+func encodeWords(s string) string {
+	const maxChunk = 45 // bytes of text per word; 60 in base64 keeps the word under 75
+	var words []string
+	for len(s) > 0 {
+		n := len(s)
+		if n > maxChunk {
+			n = maxChunk
+			for n > 0 && !utf8.RuneStart(s[n]) {
+				n--
+			}
+		}
+		words = append(words, "=?UTF-8?b?"+base64.StdEncoding.EncodeToString([]byte(s[:n]))+"?=")
+		s = s[n:]
+	}
+	return strings.Join(words, " ")
+}
+
+// parseAddress parses a single address, rejecting line breaks and control characters that
+// net/mail would let through in a display name
+func parseAddress(value string) (*mail.Address, error) {
+	if hasControlChars(value) {
+		return nil, fmt.Errorf("contains control characters")
+	}
+	return mail.ParseAddress(value)
+}
+
+// hasControlChars reports whether s has a line break or another control character
+func hasControlChars(s string) bool {
+	return strings.IndexFunc(s, unsafeHeaderRune) >= 0
+}
+
+// unsafeHeaderRune reports control characters (including CR, LF and NEL) and the Unicode
+// line and paragraph separators, which some clients also break lines at
+func unsafeHeaderRune(r rune) bool {
+	return unicode.IsControl(r) || unicode.In(r, unicode.Zl, unicode.Zp)
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, s); err != nil {
+		return err
+	}
+	return qp.Close()
+}
 
-	if host == "" || port == "" || user == "" || pass == "" {
+// messageID is a unique Message-ID at the domain of the sender
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	return "<" + time.Now().UTC().Format("20060102150405") + "." + newRequestID() + "@" + domain + ">"
+}
+
+type SMTPConfig struct {
+	Host string
+	Port string
+	User string // no authentication when empty
+	Pass string
+	From string
+	TLS  string // SMTPStartTLS, SMTPImplicitTLS or SMTPNoTLS
+}
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer checks the TLS mode. Missing server settings only fail when sending, so
+// the site runs without email configured.
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	switch cfg.TLS {
+	case SMTPStartTLS, SMTPImplicitTLS, SMTPNoTLS:
+	default:
+		return nil, fmt.Errorf("unknown SMTP_TLS %q (expected starttls, tls or none)", cfg.TLS)
+	}
+	return &SMTPMailer{cfg: cfg}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, e Email) error {
+	cfg := m.cfg
+	if cfg.Host == "" || cfg.Port == "" {
 		return fmt.Errorf("SMTP configuration is missing")
 	}
+	if e.From == "" {
+		e.From = cfg.From
+	}
+	if e.From == "" {
+		return fmt.Errorf("no sender address (set CONTACT_FROM)")
+	}
+	// Build the message first so a bad address or header fails before connecting
+	msg, err := composeEmail(e)
+	if err != nil {
+		return err
+	}
+	from, _ := mail.ParseAddress(e.From)
+	to, _ := mail.ParseAddress(e.To)
 
-	if from == "" {
-		from = user
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	if cfg.TLS == SMTPImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.TLS == SMTPStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %v", err)
+		}
+	}
+	if cfg.User != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.User, cfg.Pass, cfg.Host)); err != nil {
+			// Not a permanent failure of this email: the credentials get fixed and it is retried
+			return fmt.Errorf("auth: %v", err)
+		}
 	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
 
-	// Message composition
-	msg := fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"Reply-To: %s\r\n"+
-		"MIME-version: 1.0;\r\n"+
-		"Content-Type: text/plain; charset=\"UTF-8\";\r\n"+
-		"\r\n"+
-		"%s\r\n", from, to, subject, replyTo, body)
+// FileMailer writes each email as an .eml file to a directory, for development without
+// a mail server. The files open in any mail client.
+type FileMailer struct {
+	Dir  string
+	From string
+}
 
-	auth := smtp.PlainAuth("", user, pass, host)
-	addr := fmt.Sprintf("%s:%s", host, port)
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
 
-	err := smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
+func (m *FileMailer) Send(ctx context.Context, e Email) error {
+	if e.From == "" {
+		e.From = m.From
+	}
+	msg, err := composeEmail(e)
 	if err != nil {
 		return err
 	}
+	name := time.Now().UTC().Format("20060102-150405.000") + "-" + newRequestID() + ".eml"
+	p := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(p, msg, 0o644); err != nil {
+		return err
+	}
+	log.Printf("Email to %s written to %s", e.To, p)
+	return nil
+}
+
+// MemoryMailer keeps sent email in memory so tests can inspect it
+type MemoryMailer struct {
+	From string
 
+	mu   sync.Mutex
+	sent []Email
+}
+
+func NewMemoryMailer(from string) *MemoryMailer {
+	return &MemoryMailer{From: from}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, e Email) error {
+	if e.From == "" {
+		e.From = m.From
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, e)
 	return nil
 }
 
+// Sent returns a copy of the email sent so far
+func (m *MemoryMailer) Sent() []Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Email(nil), m.sent...)
+}
 
+// Reset forgets the sent email
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = nil
+}
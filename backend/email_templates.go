@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each email is a pair of templates per locale in emails/: name.locale.txt holds the
+// subject (in a "subject" block) and the plain-text body, name.locale.html the "content"
+// of the HTML body, which layout.html wraps.
+//
+//go:embed emails/*
+var emailFiles embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// emailTemplates are keyed by "name.locale"
+var emailTemplates = mustParseEmailTemplates()
+
+func mustParseEmailTemplates() map[string]*emailTemplate {
+	files, err := fs.Glob(emailFiles, "emails/*.txt")
+	if err != nil {
+		panic(err)
+	}
+	templates := map[string]*emailTemplate{}
+	for _, f := range files {
+		key := strings.TrimSuffix(path.Base(f), ".txt")
+		templates[key] = &emailTemplate{
+			text: texttemplate.Must(texttemplate.ParseFS(emailFiles, f)),
+			html: htmltemplate.Must(htmltemplate.ParseFS(emailFiles, "emails/layout.html", "emails/"+key+".html")),
+		}
+	}
+	return templates
+}
+
+// renderEmail fills in the subject and both bodies of an email from the named template in
+// the locale, falling back to the default locale and then English. data gets a Locale key
+// and the email records the template name.
+func renderEmail(name, locale string, data map[string]interface{}) (OutboxEmail, error) {
+	var e OutboxEmail
+	t := emailTemplates[name+"."+locale]
+	for _, fallback := range []string{defaultLocale(), "en"} {
+		if t != nil {
+			break
+		}
+		locale = fallback
+		t = emailTemplates[name+"."+locale]
+	}
+	if t == nil {
+		return e, fmt.Errorf("no email template %q", name)
+	}
+	data["Locale"] = locale
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return e, err
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return e, err
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return e, err
+	}
+
+	e.Template = name
+	e.Subject = strings.TrimSpace(subject.String())
+	e.Body = text.String()
+	e.HTMLBody = html.String()
+	return e, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// headerLines returns the header section of a raw message split into lines
+func headerLines(t *testing.T, msg []byte) []string {
+	t.Helper()
+	end := bytes.Index(msg, []byte("\r\n\r\n"))
+	if end < 0 {
+		t.Fatalf("message has no header/body separator:\n%s", msg)
+	}
+	return strings.Split(string(msg[:end]), "\r\n")
+}
+
+func TestComposeEmailHeaderInjection(t *testing.T) {
+	valid := Email{From: "site@example.com", To: "owner@example.com", ReplyTo: "visitor@example.com", Subject: "Hello", Body: "Hi"}
+
+	tests := []struct {
+		name    string
+		email   func(e *Email)
+		wantErr bool
+	}{
+		{"plain", func(e *Email) {}, false},
+		{"cyrillic subject", func(e *Email) { e.Subject = "Запис на курс" }, false},
+		{"CRLF in subject", func(e *Email) { e.Subject = "Hi\r\nBcc: evil@example.com" }, false},
+		{"bare CR in subject", func(e *Email) { e.Subject = "Hi\rBcc: evil@example.com" }, false},
+		{"bare LF in subject", func(e *Email) { e.Subject = "Hi\nBcc: evil@example.com" }, false},
+		{"percent-encoded CRLF in subject", func(e *Email) { e.Subject = "Hi%0d%0aBcc: evil@example.com" }, false},
+		{"U+2028 in subject", func(e *Email) { e.Subject = "Hi\u2028Bcc: evil@example.com" }, false},
+		{"U+0085 in subject", func(e *Email) { e.Subject = "Hi\u0085Bcc: evil@example.com" }, false},
+		{"encoded word in subject", func(e *Email) { e.Subject = "=?utf-8?q?Hi=0D=0ABcc:_evil@example.com?=" }, false},
+		{"CRLF in reply-to", func(e *Email) { e.ReplyTo = "visitor@example.com\r\nBcc: evil@example.com" }, true},
+		{"bare CR in reply-to", func(e *Email) { e.ReplyTo = "visitor@example.com\rBcc: evil@example.com" }, true},
+		{"bare LF in reply-to", func(e *Email) { e.ReplyTo = "visitor@example.com\nBcc: evil@example.com" }, true},
+		{"percent-encoded CRLF in reply-to", func(e *Email) { e.ReplyTo = "visitor@example.com%0d%0aBcc:evil@example.com" }, true},
+		{"U+2028 in reply-to", func(e *Email) { e.ReplyTo = "visitor@example.com\u2028Bcc: evil@example.com" }, true},
+		{"U+0085 in reply-to", func(e *Email) { e.ReplyTo = "visitor@example.com\u0085Bcc: evil@example.com" }, true},
+		{"reply-to with a trailing header", func(e *Email) { e.ReplyTo = "visitor@example.com\r\nX-Injected: 1" }, true},
+		{"second recipient in reply-to", func(e *Email) { e.ReplyTo = "visitor@example.com, evil@example.com" }, true},
+		{"display name with CRLF Bcc", func(e *Email) { e.To = "\"Owner\r\nBcc: evil@example.com\" <owner@example.com>" }, true},
+		{"display name with quoted Bcc", func(e *Email) { e.To = "\"\\\"\r\nBcc: evil@example.com\" <owner@example.com>" }, true},
+		{"encoded word display name", func(e *Email) { e.To = "=?utf-8?q?Owner=0D=0ABcc:_evil@example.com?= <owner@example.com>" }, true},
+	}
+
+	allowed := map[string]bool{
+		"From": true, "To": true, "Reply-To": true, "Subject": true, "Date": true,
+		"Message-Id": true, "Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := valid
+			tt.email(&e)
+
+			msg, err := composeEmail(e)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got message:\n%s", msg)
+				}
+				if !errors.Is(err, errInvalidMessage) {
+					t.Errorf("error %v is not errInvalidMessage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// One header per line: no continuation lines and nothing beyond the known headers
+			lines := headerLines(t, msg)
+			if len(lines) != 9 {
+				t.Errorf("got %d header lines, want 9:\n%s", len(lines), strings.Join(lines, "\n"))
+			}
+			for _, line := range lines {
+				key, _, ok := strings.Cut(line, ":")
+				if !ok || strings.ContainsAny(key, " \t") {
+					t.Errorf("malformed header line %q", line)
+					continue
+				}
+				if !allowed[http.CanonicalHeaderKey(key)] {
+					t.Errorf("unexpected header %q", line)
+				}
+			}
+
+			parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+			if err != nil {
+				t.Fatalf("message does not parse: %v", err)
+			}
+			if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+				t.Errorf("injected Bcc: %q", bcc)
+			}
+			if to, err := parsed.Header.AddressList("To"); err != nil || len(to) != 1 {
+				t.Errorf("To = %v (%v), want one address", to, err)
+			}
+		})
+	}
+}
+
+func TestContactValidationRejectsInjection(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		req   func(r *ContactRequest)
+	}{
+		{"CRLF in subject", "subject", func(r *ContactRequest) { r.Subject = "Hi\r\nBcc: evil@example.com" }},
+		{"bare CR in subject", "subject", func(r *ContactRequest) { r.Subject = "Hi\rBcc: evil@example.com" }},
+		{"bare LF in subject", "subject", func(r *ContactRequest) { r.Subject = "Hi\nBcc: evil@example.com" }},
+		{"percent-encoded CRLF in subject", "subject", func(r *ContactRequest) { r.Subject = "Hi%0d%0aBcc: evil@example.com" }},
+		{"U+2028 in subject", "subject", func(r *ContactRequest) { r.Subject = "Hi\u2028Bcc: evil@example.com" }},
+		{"U+0085 in subject", "subject", func(r *ContactRequest) { r.Subject = "Hi\u0085Bcc: evil@example.com" }},
+		{"encoded word in subject", "subject", func(r *ContactRequest) { r.Subject = "=?utf-8?q?Hi=0D=0ABcc:_evil@example.com?=" }},
+		{"CRLF in name", "name", func(r *ContactRequest) { r.Name = "Olena\r\nBcc: evil@example.com" }},
+		{"display name with CRLF Bcc", "name", func(r *ContactRequest) { r.Name = "\"\r\nBcc: evil@example.com" }},
+		{"encoded word in name", "name", func(r *ContactRequest) { r.Name = "=?utf-8?b?T2xlbmENCkJjYzogZXZpbEBleGFtcGxlLmNvbQ==?=" }},
+		{"CRLF in email", "email", func(r *ContactRequest) { r.Email = "visitor@example.com\r\nBcc: evil@example.com" }},
+		{"bare LF in email", "email", func(r *ContactRequest) { r.Email = "visitor@example.com\nBcc: evil@example.com" }},
+		{"percent-encoded CRLF in email", "email", func(r *ContactRequest) { r.Email = "visitor@example.com%0d%0aBcc:evil@example.com" }},
+		{"U+2028 in email", "email", func(r *ContactRequest) { r.Email = "visitor@example.com\u2028Bcc: evil@example.com" }},
+		{"email with a trailing header", "email", func(r *ContactRequest) { r.Email = "visitor@example.com\r\nX-Injected: 1" }},
+		{"display name in email", "email", func(r *ContactRequest) { r.Email = "\"Visitor\r\nBcc: evil@example.com\" <visitor@example.com>" }},
+		{"two addresses in email", "email", func(r *ContactRequest) { r.Email = "visitor@example.com, evil@example.com" }},
+	}
+
+	s := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ContactRequest{
+				Name:      "Olena",
+				Email:     "visitor@example.com",
+				Subject:   "Hello",
+				Message:   "Hi there",
+				CreatedAt: time.Now().Add(-time.Minute).UnixMilli(),
+			}
+			tt.req(&req)
+
+			if errs := validateContact(&req); errs[tt.field] == "" {
+				t.Errorf("validateContact accepted %s %q (errors: %v)", tt.field, fieldValue(req, tt.field), errs)
+			}
+
+			body, _ := json.Marshal(req)
+			rec := httptest.NewRecorder()
+			s.handleContact(rec, httptest.NewRequest(http.MethodPost, "/api/contact", bytes.NewReader(body)))
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want 422; body: %s", rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), `"`+tt.field+`"`) {
+				t.Errorf("response does not name the %s field: %s", tt.field, rec.Body)
+			}
+		})
+	}
+}
+
+func fieldValue(r ContactRequest, field string) string {
+	switch field {
+	case "name":
+		return r.Name
+	case "email":
+		return r.Email
+	default:
+		return r.Subject
+	}
+}
+
+func TestPermanentSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"invalid message", fmt.Errorf("%w: To address", errInvalidMessage), true},
+		{"mailbox unavailable", &textproto.Error{Code: 550, Msg: "no such user"}, true},
+		{"wrapped 5xx", fmt.Errorf("RCPT TO: %w", &textproto.Error{Code: 553, Msg: "not permitted"}), true},
+		{"greylisted", &textproto.Error{Code: 451, Msg: "try again later"}, false},
+		{"mailbox full", fmt.Errorf("DATA: %w", &textproto.Error{Code: 452, Msg: "insufficient storage"}), false},
+		// Login and TLS failures are fixed in the configuration, not the message
+		{"auth failure", fmt.Errorf("smtp auth: %v", &textproto.Error{Code: 535, Msg: "bad credentials"}), false},
+		{"connection refused", errors.New("dial tcp: connection refused"), false},
+		{"timeout", context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permanentSendError(tt.err); got != tt.want {
+				t.Errorf("permanentSendError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	EnrollmentEnrolled   = "enrolled"
+	EnrollmentWaitlisted = "waitlisted"
+	EnrollmentCancelled  = "cancelled"
+)
+
+type Enrollment struct {
+	ID        string    `json:"id"`
+	CourseID  string    `json:"courseId"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Locale    string    `json:"locale"`
+	Status    string    `json:"status"`
+	Position  int       `json:"position,omitempty"` // place on the waitlist
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type EnrollmentRequest struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	Website   string `json:"website"` // Honeypot
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// spotsLeft is what is left of a course's capacity, never below zero
+func spotsLeft(capacity, enrolled int) *int {
+	n := capacity - enrolled
+	if n < 0 {
+		n = 0
+	}
+	return &n
+}
+
+// enrollInCourse signs a visitor up for a course. Once the course is full new
+// enrollments go on the waitlist.
+func (s *Server) enrollInCourse(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req EnrollmentRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Same bot checks as the contact form
+	if req.Website != "" {
+		log.Printf("Bot detected (honeypot) on enrollment: %s", req.Email)
+		// Return success to confuse the bot
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": EnrollmentEnrolled,
+		})
+		return
+	}
+	if time.Now().UnixMilli()-req.CreatedAt < 2000 {
+		log.Printf("Bot suspected (too fast) on enrollment: %s", req.Email)
+		writeError(w, http.StatusTooManyRequests, "Too fast. Please wait a moment.")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	req.Phone = strings.TrimSpace(req.Phone)
+	if errs := validateEnrollment(&req); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the course serializes enrollments, so two visitors cannot take the last spot
+	var title string
+	var open bool
+	var capacity sql.NullInt64
+	err = tx.QueryRow("SELECT title, enrollment_open, capacity FROM courses WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&title, &open, &capacity)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if !open {
+		writeError(w, http.StatusConflict, "Enrollment is closed for this course")
+		return
+	}
+
+	var existing string
+	err = tx.QueryRow("SELECT status FROM course_enrollments WHERE course_id=$1 AND lower(email)=$2 AND status<>$3", id, req.Email, EnrollmentCancelled).Scan(&existing)
+	if err == nil {
+		if existing == EnrollmentWaitlisted {
+			writeError(w, http.StatusConflict, "This email is already on the waitlist for this course")
+		} else {
+			writeError(w, http.StatusConflict, "This email is already enrolled in this course")
+		}
+		return
+	}
+	if err != sql.ErrNoRows {
+		writeInternalError(w, err)
+		return
+	}
+
+	e := Enrollment{CourseID: id, Name: req.Name, Email: req.Email, Phone: req.Phone, Locale: locale, Status: EnrollmentEnrolled}
+	if capacity.Valid {
+		var enrolled int64
+		if err := tx.QueryRow("SELECT COUNT(*) FROM course_enrollments WHERE course_id=$1 AND status=$2", id, EnrollmentEnrolled).Scan(&enrolled); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if enrolled >= capacity.Int64 {
+			e.Status = EnrollmentWaitlisted
+		}
+	}
+
+	err = tx.QueryRow(
+		"INSERT INTO course_enrollments (course_id, name, email, phone, locale, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+		e.CourseID, e.Name, e.Email, e.Phone, e.Locale, e.Status,
+	).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if e.Status == EnrollmentWaitlisted {
+		err := tx.QueryRow("SELECT COUNT(*) FROM course_enrollments WHERE course_id=$1 AND status=$2", id, EnrollmentWaitlisted).Scan(&e.Position)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if err := queueEnrollmentEmail(tx, e, title, false); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	wakeOutbox()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   e.Status,
+		"position": e.Position,
+	})
+}
+
+// promoteWaitlist moves waitlisted enrollments of a course into the spots that are free
+// and queues an email to each promoted enrollee. Call wakeOutbox after the commit.
+func promoteWaitlist(tx *sql.Tx, r *http.Request, courseID string) ([]Enrollment, error) {
+	var title string
+	var capacity sql.NullInt64
+	if err := tx.QueryRow("SELECT title, capacity FROM courses WHERE id=$1 FOR UPDATE", courseID).Scan(&title, &capacity); err != nil {
+		return nil, err
+	}
+
+	// A NULL limit promotes everyone, which is what removing the capacity means
+	var free sql.NullInt64
+	if capacity.Valid {
+		var enrolled int64
+		if err := tx.QueryRow("SELECT COUNT(*) FROM course_enrollments WHERE course_id=$1 AND status=$2", courseID, EnrollmentEnrolled).Scan(&enrolled); err != nil {
+			return nil, err
+		}
+		if enrolled >= capacity.Int64 {
+			return nil, nil
+		}
+		free = sql.NullInt64{Int64: capacity.Int64 - enrolled, Valid: true}
+	}
+
+	rows, err := tx.Query(`
+		UPDATE course_enrollments SET status=$2, updated_at=CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM course_enrollments WHERE course_id=$1 AND status=$3
+			ORDER BY created_at, id LIMIT $4
+		)
+		RETURNING id, course_id, name, email, phone, locale, status, created_at, updated_at`,
+		courseID, EnrollmentEnrolled, EnrollmentWaitlisted, free,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []Enrollment
+	for rows.Next() {
+		var e Enrollment
+		if err := rows.Scan(&e.ID, &e.CourseID, &e.Name, &e.Email, &e.Phone, &e.Locale, &e.Status, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		promoted = append(promoted, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, e := range promoted {
+		err := insertAudit(tx, r, "enrollment", e.ID, "update", map[string]FieldChange{
+			"status": {From: EnrollmentWaitlisted, To: EnrollmentEnrolled},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := queueEnrollmentEmail(tx, e, title, true); err != nil {
+			return nil, err
+		}
+	}
+	return promoted, nil
+}
+
+// queueEnrollmentEmail confirms an enrollment, a place on the waitlist or a promotion off it
+func queueEnrollmentEmail(ex execer, e Enrollment, courseTitle string, promoted bool) error {
+	courses := []Course{{ID: e.CourseID, Title: courseTitle}}
+	if err := translateCourses(e.Locale, courses); err != nil {
+		return err
+	}
+	title := courses[0].Title
+
+	name := "enrollment_enrolled"
+	switch {
+	case e.Status == EnrollmentWaitlisted:
+		name = "enrollment_waitlisted"
+	case promoted:
+		name = "enrollment_promoted"
+	}
+	email, err := renderEmail(name, e.Locale, map[string]interface{}{"Name": e.Name, "Course": title, "Position": e.Position})
+	if err != nil {
+		return err
+	}
+	email.To, email.ReplyTo = e.Email, contactAddress()
+	return queueEmail(ex, email)
+}
+
+// loadEnrollments lists a course's enrollments in sign-up order, optionally of one status.
+// Waitlisted enrollments get their position.
+func loadEnrollments(courseID, status string) ([]Enrollment, error) {
+	rows, err := db.Query(`
+		SELECT id, course_id, name, email, phone, locale, status, created_at, updated_at,
+			ROW_NUMBER() OVER (PARTITION BY status ORDER BY created_at, id)
+		FROM course_enrollments
+		WHERE course_id=$1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at, id`, courseID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enrollments := []Enrollment{}
+	for rows.Next() {
+		var e Enrollment
+		var position int
+		if err := rows.Scan(&e.ID, &e.CourseID, &e.Name, &e.Email, &e.Phone, &e.Locale, &e.Status, &e.CreatedAt, &e.UpdatedAt, &position); err != nil {
+			return nil, err
+		}
+		if e.Status == EnrollmentWaitlisted {
+			e.Position = position
+		}
+		enrollments = append(enrollments, e)
+	}
+	return enrollments, rows.Err()
+}
+
+// enrollmentCourse loads the title and capacity of a course for the admin endpoints.
+// Trashed courses are included so their enrollees can still be exported.
+func enrollmentCourse(w http.ResponseWriter, id string) (string, sql.NullInt64, bool) {
+	var title string
+	var capacity sql.NullInt64
+	err := db.QueryRow("SELECT title, capacity FROM courses WHERE id=$1", id).Scan(&title, &capacity)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Course not found")
+		return "", capacity, false
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return "", capacity, false
+	}
+	return title, capacity, true
+}
+
+// enrollmentStatusFilter reads ?status=, answering 400 for an unknown status
+func enrollmentStatusFilter(w http.ResponseWriter, r *http.Request) (string, bool) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", EnrollmentEnrolled, EnrollmentWaitlisted, EnrollmentCancelled:
+		return status, true
+	}
+	writeError(w, http.StatusBadRequest, "Invalid status (expected enrolled, waitlisted or cancelled)")
+	return "", false
+}
+
+func (s *Server) getEnrollments(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	status, ok := enrollmentStatusFilter(w, r)
+	if !ok {
+		return
+	}
+	title, capacity, ok := enrollmentCourse(w, id)
+	if !ok {
+		return
+	}
+
+	enrollments, err := loadEnrollments(id, status)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	counts := map[string]int{EnrollmentEnrolled: 0, EnrollmentWaitlisted: 0, EnrollmentCancelled: 0}
+	rows, err := db.Query("SELECT status, COUNT(*) FROM course_enrollments WHERE course_id=$1 GROUP BY status", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st string
+		var n int
+		if err := rows.Scan(&st, &n); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		counts[st] = n
+	}
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"courseId": id,
+		"title":    title,
+		"capacity": nil,
+		"counts":   counts,
+		"items":    enrollments,
+	}
+	if capacity.Valid {
+		resp["capacity"] = capacity.Int64
+		resp["spotsLeft"] = spotsLeft(int(capacity.Int64), counts[EnrollmentEnrolled])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// exportEnrollments downloads a course's enrollments as CSV
+func (s *Server) exportEnrollments(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	status, ok := enrollmentStatusFilter(w, r)
+	if !ok {
+		return
+	}
+	if _, _, ok := enrollmentCourse(w, id); !ok {
+		return
+	}
+
+	enrollments, err := loadEnrollments(id, status)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="enrollments-`+id+`.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"status", "position", "name", "email", "phone", "locale", "enrolled_at"})
+	for _, e := range enrollments {
+		position := ""
+		if e.Position > 0 {
+			position = strconv.Itoa(e.Position)
+		}
+		cw.Write([]string{e.Status, position, csvSafe(e.Name), csvSafe(e.Email), csvSafe(e.Phone), e.Locale, e.CreatedAt.UTC().Format(time.RFC3339)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error writing enrollment export for course %s: %v", id, err)
+	}
+}
+
+// csvSafe keeps spreadsheet apps from running visitor input as a formula
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// cancelEnrollment cancels an enrollment; the spot it frees goes to the waitlist
+func (s *Server) cancelEnrollment(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	courseID, enrollmentID := params["id"], params["enrollmentId"]
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the course like enrollInCourse does, so the freed spot is not taken twice
+	var locked string
+	err = tx.QueryRow("SELECT id FROM courses WHERE id=$1 FOR UPDATE", courseID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM course_enrollments WHERE id=$1 AND course_id=$2", enrollmentID, courseID).Scan(&status)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Enrollment not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if status == EnrollmentCancelled {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE course_enrollments SET status=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2", EnrollmentCancelled, enrollmentID); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	err = insertAudit(tx, r, "enrollment", enrollmentID, "update", map[string]FieldChange{
+		"status": {From: status, To: EnrollmentCancelled},
+	})
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var promoted []Enrollment
+	if status == EnrollmentEnrolled {
+		promoted, err = promoteWaitlist(tx, r, courseID)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if len(promoted) > 0 {
+		wakeOutbox()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
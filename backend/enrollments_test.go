@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestSpotsLeft(t *testing.T) {
+	tests := []struct {
+		capacity, enrolled, want int
+	}{
+		{10, 0, 10},
+		{10, 3, 7},
+		{10, 10, 0},
+		// Capacity lowered below the number already enrolled
+		{5, 8, 0},
+		{1, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := spotsLeft(tt.capacity, tt.enrolled); got == nil || *got != tt.want {
+			t.Errorf("spotsLeft(%d, %d) = %v, want %d", tt.capacity, tt.enrolled, got, tt.want)
+		}
+	}
+}
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Olena", "Olena"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+380441234567", "'+380441234567"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"a=1", "a=1"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.in); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
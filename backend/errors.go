@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// Error codes sent in the "code" field of every error response
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidJSON      = "invalid_json"
+	CodeInvalidID        = "invalid_id"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeTooLarge         = "payload_too_large"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal_error"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// APIError is an error answered to the client. Cause is logged with the request ID and
+// never sent, so database and driver messages stay on the server.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details FieldErrors
+	Cause   error
+}
+
+func (e *APIError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Cause
+}
+
+type errorBody struct {
+	Error errorPayload `json:"error"`
+}
+
+type errorPayload struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   FieldErrors `json:"details,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// codeForStatus is the default code of an HTTP status
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMedia
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	}
+	return CodeInternal
+}
+
+// writeAPIError renders e as the JSON error envelope
+func writeAPIError(w http.ResponseWriter, e *APIError) {
+	requestID := w.Header().Get(requestIDHeader)
+	if e.Cause != nil {
+		log.Printf("[%s] %d %s: %v", requestID, e.Status, e.Message, e.Cause)
+	}
+	code := e.Code
+	if code == "" {
+		code = codeForStatus(e.Status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(errorBody{Error: errorPayload{
+		Code:      code,
+		Message:   e.Message,
+		Details:   e.Details,
+		RequestID: requestID,
+	}})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, &APIError{Status: status, Message: message})
+}
+
+// writeInternalError logs err and answers a generic 500
+func writeInternalError(w http.ResponseWriter, err error) {
+	writeAPIError(w, &APIError{Status: http.StatusInternalServerError, Message: "Internal server error", Cause: err})
+}
+
+// writeValidationError answers 422 with a message per invalid field
+func writeValidationError(w http.ResponseWriter, fields FieldErrors) {
+	writeAPIError(w, &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: "Validation failed", Details: fields})
+}
+
+// decodeJSON reads the request body into v, answering 400 when it is not valid JSON
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Message: "Request body is not valid JSON", Cause: err})
+		return false
+	}
+	return true
+}
+
+// requestIDMiddleware tags every request with an ID, reusing a well-formed X-Request-ID
+// from the client. The ID is echoed in the response header and in error bodies.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "Route not found")
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
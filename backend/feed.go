@@ -0,0 +1,518 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const feedSize = 50
+
+type feedMeta struct {
+	Title       string
+	Description string
+	SiteURL     string
+	FeedURL     string
+	Updated     time.Time
+}
+
+type feedEntry struct {
+	Article
+	URL       string
+	ImageURL  string
+	ImageSize int64 // bytes, known only for images from the media library
+	ImageType string
+	HTML      string
+	Published time.Time
+}
+
+// siteURL is the public address of the frontend, used for links in feeds
+func siteURL() string {
+	u := os.Getenv("SITE_URL")
+	if u == "" {
+		u = "http://localhost:4321"
+	}
+	return strings.TrimRight(u, "/")
+}
+
+func absoluteURL(p string) string {
+	if p == "" || strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://") {
+		return p
+	}
+	return siteURL() + "/" + strings.TrimLeft(p, "/")
+}
+
+// apiURL is the public address of this API, API_URL or SITE_URL/api by default. Feed
+// self links use it instead of the request's Host, which clients control.
+func apiURL() string {
+	if u := os.Getenv("API_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return siteURL() + "/api"
+}
+
+// articleURL is the canonical page of an article
+func articleURL(a Article) string {
+	if a.Slug != "" {
+		return siteURL() + "/blog/" + url.PathEscape(a.Slug)
+	}
+	return siteURL() + "/blog/" + a.ID
+}
+
+// feedVersion returns the time of the latest change to the feed and its ETag
+func feedVersion(format, category string) (time.Time, string, error) {
+	where := publishedArticleFilter
+	args := []interface{}{}
+	if category != "" {
+		where += " AND category=$1"
+		args = append(args, category)
+	}
+
+	var lastModified time.Time
+	var count int
+	err := db.QueryRow(
+		"SELECT COALESCE(GREATEST(MAX(updated_at), MAX(publish_at)), 'epoch'), COUNT(*) FROM articles WHERE "+where,
+		args...,
+	).Scan(&lastModified, &count)
+	if err != nil {
+		return lastModified, "", err
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d", format, category, lastModified.UnixNano(), count)))
+	return lastModified, `W/"` + hex.EncodeToString(sum[:8]) + `"`, nil
+}
+
+// notModified sets the caching headers and reports whether the client copy is still current
+func notModified(w http.ResponseWriter, r *http.Request, lastModified time.Time, etag string) bool {
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			if tag = strings.TrimSpace(tag); tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !lastModified.Truncate(time.Second).After(ims)
+	}
+	return false
+}
+
+func loadFeedEntries(category string) ([]feedEntry, error) {
+	where := publishedArticleFilter
+	args := []interface{}{}
+	if category != "" {
+		where += " AND category=$1"
+		args = append(args, category)
+	}
+
+	rows, err := db.Query(
+		"SELECT "+articleColumns+" FROM articles WHERE "+where+fmt.Sprintf(" ORDER BY COALESCE(publish_at, date::timestamptz) DESC, id DESC LIMIT %d", feedSize),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []feedEntry{}
+	for rows.Next() {
+		a, err := scanArticle(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		rc, err := renderArticleContent(a.ID, defaultLocale(), a.UpdatedAt, a.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		e := feedEntry{
+			Article:  a,
+			URL:      articleURL(a),
+			ImageURL: absoluteURL(a.Image),
+			HTML:     rc.HTML,
+		}
+		if a.PublishAt != nil {
+			e.Published = *a.PublishAt
+		} else if d, err := time.Parse("2006-01-02", a.Date); err == nil {
+			e.Published = d
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RSS enclosures need the byte length, which only the media library knows
+	images := make([]string, len(entries))
+	for i, e := range entries {
+		images[i] = e.Image
+	}
+	files, err := loadMediaFiles(images)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if f, ok := files[entries[i].Image]; ok {
+			entries[i].ImageSize, entries[i].ImageType = f.size, f.contentType
+		}
+	}
+	return entries, nil
+}
+
+type mediaFile struct {
+	size        int64
+	contentType string
+}
+
+// loadMediaFiles looks up the size and type of uploaded files by their URL
+func loadMediaFiles(urls []string) (map[string]mediaFile, error) {
+	files := map[string]mediaFile{}
+	rows, err := db.Query("SELECT url, size_bytes, content_type FROM media WHERE url = ANY($1)", pq.Array(urls))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaURL string
+		var f mediaFile
+		if err := rows.Scan(&mediaURL, &f.size, &f.contentType); err != nil {
+			return nil, err
+		}
+		files[mediaURL] = f
+	}
+	return files, rows.Err()
+}
+
+// feedURL is the public address of a feed; only the category is kept from the query
+func feedURL(routePath, category string) string {
+	u := apiURL() + "/" + path.Base(routePath)
+	if category != "" {
+		u += "?category=" + url.QueryEscape(category)
+	}
+	return u
+}
+
+// serveFeed loads the published articles and writes them with the given encoder
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request, format, contentType string, encode func(meta feedMeta, entries []feedEntry) ([]byte, error)) {
+	category := r.URL.Query().Get("category")
+
+	lastModified, etag, err := feedVersion(format, category)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if notModified(w, r, lastModified, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	entries, err := loadFeedEntries(category)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	siteName := os.Getenv("SITE_NAME")
+	if siteName == "" {
+		siteName = "Antonina Devitska"
+	}
+	meta := feedMeta{
+		Title:       siteName + " — Blog",
+		Description: "Articles on wellbeing, emotional fitness and personal growth",
+		SiteURL:     siteURL() + "/blog",
+		FeedURL:     feedURL(r.URL.Path, category),
+		Updated:     lastModified,
+	}
+	if category != "" {
+		meta.Title += ": " + category
+	}
+
+	body, err := encode(meta, entries)
+	if err != nil {
+		log.Printf("Error encoding %s feed: %v", format, err)
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// RSS 2.0
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	DCNS      string     `xml:"xmlns:dc,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	LastBuildDate string      `xml:"lastBuildDate"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	Description string        `xml:"description"`
+	Content     cdata         `xml:"content:encoded"`
+	Creator     string        `xml:"dc:creator,omitempty"`
+	Category    string        `xml:"category,omitempty"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+func (s *Server) getRSSFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, "rss", "application/rss+xml; charset=utf-8", func(meta feedMeta, entries []feedEntry) ([]byte, error) {
+		feed := rssFeed{
+			Version:   "2.0",
+			ContentNS: "http://purl.org/rss/1.0/modules/content/",
+			DCNS:      "http://purl.org/dc/elements/1.1/",
+			AtomNS:    "http://www.w3.org/2005/Atom",
+			Channel: rssChannel{
+				Title:         meta.Title,
+				Link:          meta.SiteURL,
+				Description:   meta.Description,
+				LastBuildDate: meta.Updated.UTC().Format(time.RFC1123Z),
+				AtomLink:      rssAtomLink{Href: meta.FeedURL, Rel: "self", Type: "application/rss+xml"},
+				Items:         []rssItem{},
+			},
+		}
+
+		for _, e := range entries {
+			item := rssItem{
+				Title:       e.Title,
+				Link:        e.URL,
+				GUID:        rssGUID{Value: "urn:uuid:" + e.ID},
+				Description: e.Excerpt,
+				Content:     cdata{Value: e.HTML},
+				Creator:     e.Author,
+				Category:    e.Category,
+				PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			}
+			// RSS requires the real length, so images from outside the media library get none
+			if e.ImageURL != "" && e.ImageSize > 0 {
+				item.Enclosure = &rssEnclosure{URL: e.ImageURL, Length: e.ImageSize, Type: e.ImageType}
+			}
+			feed.Channel.Items = append(feed.Channel.Items, item)
+		}
+
+		out, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), out...), nil
+	})
+}
+
+// Atom 1.0
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string        `xml:"title"`
+	ID        string        `xml:"id"`
+	Updated   string        `xml:"updated"`
+	Published string        `xml:"published"`
+	Links     []atomLink    `xml:"link"`
+	Author    *atomPerson   `xml:"author"`
+	Category  *atomCategory `xml:"category"`
+	Summary   *atomText     `xml:"summary"`
+	Content   atomText      `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (s *Server) getAtomFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, "atom", "application/atom+xml; charset=utf-8", func(meta feedMeta, entries []feedEntry) ([]byte, error) {
+		feed := atomFeed{
+			Title:    meta.Title,
+			Subtitle: meta.Description,
+			ID:       meta.FeedURL,
+			Updated:  meta.Updated.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: meta.SiteURL, Rel: "alternate", Type: "text/html"},
+				{Href: meta.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			},
+		}
+
+		for _, e := range entries {
+			entry := atomEntry{
+				Title:     e.Title,
+				ID:        "urn:uuid:" + e.ID,
+				Updated:   e.UpdatedAt.UTC().Format(time.RFC3339),
+				Published: e.Published.UTC().Format(time.RFC3339),
+				Links:     []atomLink{{Href: e.URL, Rel: "alternate", Type: "text/html"}},
+				Content:   atomText{Type: "html", Value: e.HTML},
+			}
+			if e.ImageURL != "" {
+				link := atomLink{Href: e.ImageURL, Rel: "enclosure", Type: imageMimeType(e.ImageURL), Length: e.ImageSize}
+				if e.ImageType != "" {
+					link.Type = e.ImageType
+				}
+				entry.Links = append(entry.Links, link)
+			}
+			if e.Author != "" {
+				entry.Author = &atomPerson{Name: e.Author}
+			}
+			if e.Category != "" {
+				entry.Category = &atomCategory{Term: e.Category}
+			}
+			if e.Excerpt != "" {
+				entry.Summary = &atomText{Type: "text", Value: e.Excerpt}
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+
+		out, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), out...), nil
+	})
+}
+
+// JSON Feed 1.1
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) getJSONFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, "json", "application/feed+json; charset=utf-8", func(meta feedMeta, entries []feedEntry) ([]byte, error) {
+		feed := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       meta.Title,
+			HomePageURL: meta.SiteURL,
+			FeedURL:     meta.FeedURL,
+			Description: meta.Description,
+			Items:       []jsonFeedItem{},
+		}
+
+		for _, e := range entries {
+			item := jsonFeedItem{
+				ID:            e.ID,
+				URL:           e.URL,
+				Title:         e.Title,
+				ContentHTML:   e.HTML,
+				Summary:       e.Excerpt,
+				Image:         e.ImageURL,
+				DatePublished: e.Published.UTC().Format(time.RFC3339),
+				DateModified:  e.UpdatedAt.UTC().Format(time.RFC3339),
+			}
+			if e.Author != "" {
+				item.Authors = []jsonFeedAuthor{{Name: e.Author}}
+			}
+			if e.Category != "" {
+				item.Tags = []string{e.Category}
+			}
+			feed.Items = append(feed.Items, item)
+		}
+
+		return json.Marshal(feed)
+	})
+}
+
+func imageMimeType(u string) string {
+	if t := mime.TypeByExtension(path.Ext(u)); t != "" {
+		return t
+	}
+	return "image/jpeg"
+}
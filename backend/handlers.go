@@ -12,33 +12,104 @@ import (
 
 // Article Handlers
 
+const articleColumns = "id, COALESCE(slug, ''), title, COALESCE(excerpt, ''), content, COALESCE(author, ''), COALESCE(date, created_at::date), COALESCE(category, ''), COALESCE(category_id::text, ''), featured, COALESCE(image, ''), status, publish_at, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanArticle(row rowScanner) (Article, error) {
+	var a Article
+	var date time.Time
+	var publishAt sql.NullTime
+	err := row.Scan(&a.ID, &a.Slug, &a.Title, &a.Excerpt, &a.Content, &a.Author, &date, &a.Category, &a.CategoryID, &a.Featured, &a.Image, &a.Status, &publishAt, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return a, err
+	}
+	a.Date = date.Format("2006-01-02")
+	a.CategoryRef = categoryRef(a.CategoryID, a.Category, "blog")
+	if publishAt.Valid {
+		a.PublishAt = &publishAt.Time
+	}
+
+	// Fallback for missing image
+	if a.Image == "" {
+		a.Image = "/images/blog-1.png"
+	}
+
+	return a, nil
+}
+
 func (s *Server) getArticles(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, title, COALESCE(excerpt, ''), content, COALESCE(author, ''), date, COALESCE(category, ''), featured, COALESCE(image, ''), created_at, updated_at FROM articles ORDER BY date DESC")
+	params, err := parseArticleListParams(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer rows.Close()
+
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	query, args, countQuery, countArgs := articleListQuery(r, params)
 
 	articles := []Article{}
+	var total int
+	if err := db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var a Article
-		var date time.Time
-		err := rows.Scan(&a.ID, &a.Title, &a.Excerpt, &a.Content, &a.Author, &date, &a.Category, &a.Featured, &a.Image, &a.CreatedAt, &a.UpdatedAt)
+		a, err := scanArticle(rows)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
-		a.Date = date.Format("2006-01-02")
-		
-		// Fallback for missing image
-		if a.Image == "" {
-			a.Image = "/images/blog-1.png"
-		}
-		
 		articles = append(articles, a)
 	}
 
+	// One extra row was fetched to know whether another page follows
+	var nextCursor string
+	if len(articles) > params.Limit {
+		articles = articles[:params.Limit]
+		nextCursor = cursorFor(articles[len(articles)-1], params.Sort)
+	}
+
+	if err := translateArticles(locale, articles); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// Lists stay light unless the full content is asked for
+	if !params.IncludeContent {
+		for i := range articles {
+			articles[i].Content = ""
+		}
+	}
+
+	urls := make([]string, len(articles))
+	for i := range articles {
+		urls[i] = articles[i].Image
+	}
+	sets, err := loadImageSets(urls)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	for i := range articles {
+		articles[i].ImageSet = sets[articles[i].Image]
+	}
+
+	setPageHeaders(w, r, total, nextCursor)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(articles)
 }
@@ -47,47 +118,179 @@ func (s *Server) getArticle(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
-	var a Article
-	var date time.Time
-	err := db.QueryRow(
-		"SELECT id, title, COALESCE(excerpt, ''), content, COALESCE(author, ''), date, COALESCE(category, ''), featured, COALESCE(image, ''), created_at, updated_at FROM articles WHERE id=$1",
-		id,
-	).Scan(&a.ID, &a.Title, &a.Excerpt, &a.Content, &a.Author, &date, &a.Category, &a.Featured, &a.Image, &a.CreatedAt, &a.UpdatedAt)
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
 
+	a, err := scanArticle(db.QueryRow("SELECT "+articleColumns+" FROM articles WHERE id=$1 AND "+articleVisibility(r), id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "Article not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "Article not found")
 		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 		}
 		return
 	}
 
-	a.Date = date.Format("2006-01-02")
+	if err := translateArticle(locale, &a); err != nil {
+		writeInternalError(w, err)
+		return
+	}
 
-	// Fallback for missing image
-	if a.Image == "" {
-		a.Image = "/images/blog-1.png"
+	if r.URL.Query().Get("render") == "html" {
+		if err := applyRenderedContent(&a, locale); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+	if err := attachArticleImageSet(&a); err != nil {
+		writeInternalError(w, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(a)
 }
 
+// getArticleBySlug looks up an article by its current slug. A slug the article had before
+// being renamed answers with a 301 pointing at the current slug.
+func (s *Server) getArticleBySlug(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	a, err := scanArticle(db.QueryRow("SELECT "+articleColumns+" FROM articles WHERE slug=$1 AND "+articleVisibility(r), slug))
+	if err == nil {
+		if err := translateArticle(locale, &a); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if r.URL.Query().Get("render") == "html" {
+			if err := applyRenderedContent(&a, locale); err != nil {
+				writeInternalError(w, err)
+				return
+			}
+		}
+		if err := attachArticleImageSet(&a); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a)
+		return
+	}
+	if err != sql.ErrNoRows {
+		writeInternalError(w, err)
+		return
+	}
+
+	var currentSlug string
+	err = db.QueryRow(
+		"SELECT a.slug FROM article_slug_history h JOIN (SELECT id, slug FROM articles WHERE "+articleVisibility(r)+") a ON a.id = h.article_id WHERE h.slug=$1",
+		slug,
+	).Scan(&currentSlug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Article not found")
+		} else {
+			writeInternalError(w, err)
+		}
+		return
+	}
+
+	location := "/api/articles/by-slug/" + currentSlug
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMovedPermanently)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"slug": currentSlug,
+	})
+}
+
 func (s *Server) createArticle(w http.ResponseWriter, r *http.Request) {
 	var a Article
-	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &a) {
+		return
+	}
+	if errs := validateArticle(&a, true); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	if err := normalizeArticleStatus(&a); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Without a date the article is dated by when it goes live
+	if a.Date == "" {
+		date := time.Now()
+		if a.PublishAt != nil {
+			date = *a.PublishAt
+		}
+		a.Date = date.Format("2006-01-02")
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
 		return
 	}
+	defer tx.Rollback()
 
-	err := db.QueryRow(
-		"INSERT INTO articles (title, excerpt, content, author, date, category, featured, image) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at",
-		a.Title, a.Excerpt, a.Content, a.Author, a.Date, a.Category, a.Featured, a.Image,
+	errs := FieldErrors{}
+	if err := resolveCategory(tx, "blog", &a.CategoryID, &a.Category, errs); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	base := a.Slug
+	if base == "" {
+		base = a.Title
+	}
+	slug, err := uniqueArticleSlug(tx, slugify(base), "")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	a.Slug = slug
+
+	err = tx.QueryRow(
+		"INSERT INTO articles (title, slug, excerpt, content, author, date, category, category_id, featured, image, status, publish_at, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9, $10, $11, $12, NULLIF($13, '')) RETURNING id, created_at, updated_at",
+		a.Title, a.Slug, a.Excerpt, a.Content, a.Author, a.Date, a.Category, a.CategoryID, a.Featured, a.Image, a.Status, a.PublishAt, userID,
 	).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+
+	if _, err := saveRevision(tx, r, articleRevisions, a.ID, 0); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "article", "articles", a.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -100,19 +303,107 @@ func (s *Server) updateArticle(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
+	if ok, err := canEditArticle(r, id); err != nil {
+		writeInternalError(w, err)
+		return
+	} else if !ok {
+		writeError(w, http.StatusForbidden, "Access denied: authors may only edit their own articles")
+		return
+	}
+
 	var a Article
-	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &a) {
+		return
+	}
+	if errs := validateArticle(&a, false); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	// Without a status the article keeps its current status and publish time
+	keepStatus := a.Status == ""
+	if !keepStatus {
+		if err := normalizeArticleStatus(&a); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	errs := FieldErrors{}
+	if err := resolveCategory(tx, "blog", &a.CategoryID, &a.Category, errs); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
 		return
 	}
 
-	_, err := db.Exec(
-		"UPDATE articles SET title=$1, excerpt=$2, content=$3, author=$4, date=$5, category=$6, featured=$7, image=$8, updated_at=CURRENT_TIMESTAMP WHERE id=$9",
-		a.Title, a.Excerpt, a.Content, a.Author, a.Date, a.Category, a.Featured, a.Image, id,
+	before, err := snapshotRow(tx, "articles", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// An explicit slug wins, otherwise the slug follows the title
+	base := a.Slug
+	if base == "" {
+		base = a.Title
+	}
+	slug, err := uniqueArticleSlug(tx, slugify(base), id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// Keep the old slug around so existing links can be redirected
+	_, err = tx.Exec(
+		"INSERT INTO article_slug_history (slug, article_id) SELECT slug, id FROM articles WHERE id=$1 AND slug IS NOT NULL AND slug<>$2 ON CONFLICT (slug) DO NOTHING",
+		id, slug,
+	)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	_, err = tx.Exec("DELETE FROM article_slug_history WHERE slug=$1 AND article_id=$2", slug, id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec(
+		"UPDATE articles SET title=$1, slug=$2, excerpt=$3, content=$4, author=$5, date=COALESCE(NULLIF($6, '')::date, date), category=$7, featured=$8, image=$9, status=CASE WHEN $11 THEN status ELSE $12 END, publish_at=CASE WHEN $11 THEN publish_at ELSE $13 END, category_id=NULLIF($14, '')::uuid, updated_at=CURRENT_TIMESTAMP WHERE id=$10 AND deleted_at IS NULL",
+		a.Title, slug, a.Excerpt, a.Content, a.Author, a.Date, a.Category, a.Featured, a.Image, id, keepStatus, a.Status, a.PublishAt, a.CategoryID,
 	)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Article not found")
+		return
+	}
+
+	if _, err := saveRevision(tx, r, articleRevisions, id, 0); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "article", "articles", id, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -123,9 +414,44 @@ func (s *Server) deleteArticle(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
-	_, err := db.Exec("DELETE FROM articles WHERE id=$1", id)
+	if ok, err := canEditArticle(r, id); err != nil {
+		writeInternalError(w, err)
+		return
+	} else if !ok {
+		writeError(w, http.StatusForbidden, "Access denied: authors may only delete their own articles")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "articles", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("UPDATE articles SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Article not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "article", "articles", id, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -134,52 +460,190 @@ func (s *Server) deleteArticle(w http.ResponseWriter, r *http.Request) {
 
 // Course Handlers
 
+// courseColumns are the columns read by scanCourse, with enrollment counts and the
+// totals of the course's lessons
+const courseColumns = `id, title, COALESCE(description, ''), COALESCE(lessons, ''), COALESCE(duration, ''), COALESCE(enroll_link, ''), ` + pricingColumns + `,
+	enrollment_open, capacity, (SELECT COUNT(*) FROM course_enrollments e WHERE e.course_id = courses.id AND e.status = 'enrolled'),
+	(SELECT COUNT(*) FROM course_lessons l JOIN course_modules m ON m.id = l.module_id WHERE m.course_id = courses.id),
+	(SELECT COALESCE(SUM(l.duration_minutes), 0) FROM course_lessons l JOIN course_modules m ON m.id = l.module_id WHERE m.course_id = courses.id),
+	COALESCE(category, ''), COALESCE(category_id::text, ''), tags, COALESCE(image, ''), created_at, updated_at`
+
+func scanCourse(row rowScanner, locale string, now time.Time) (Course, error) {
+	var c Course
+	var pricing pricingScan
+	var capacity sql.NullInt64
+	var enrolled int
+	dest := append([]interface{}{&c.ID, &c.Title, &c.Description, &c.Lessons, &c.Duration, &c.EnrollLink}, pricing.dest()...)
+	dest = append(dest, &c.EnrollmentOpen, &capacity, &enrolled, &c.LessonCount, &c.TotalMinutes,
+		&c.Category, &c.CategoryID, pq.Array(&c.Tags), &c.Image, &c.CreatedAt, &c.UpdatedAt)
+	if err := row.Scan(dest...); err != nil {
+		return c, err
+	}
+	c.Pricing = pricing.pricing()
+	c.Pricing.localize(locale, now)
+	if capacity.Valid {
+		limit := int(capacity.Int64)
+		c.Capacity = &limit
+		c.SpotsLeft = spotsLeft(limit, enrolled)
+	}
+	c.CategoryRef = categoryRef(c.CategoryID, c.Category, "course")
+
+	// Fallback for missing image
+	if c.Image == "" {
+		c.Image = "/images/service-1.png"
+	}
+
+	return c, nil
+}
+
 func (s *Server) getCourses(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, title, COALESCE(description, ''), COALESCE(lessons, ''), COALESCE(duration, ''), COALESCE(price, ''), COALESCE(category, ''), tags, COALESCE(image, ''), created_at, updated_at FROM courses ORDER BY created_at DESC")
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query("SELECT " + courseColumns + " FROM courses WHERE deleted_at IS NULL ORDER BY created_at DESC")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 	defer rows.Close()
 
+	now := time.Now()
 	courses := []Course{}
 	for rows.Next() {
-		var c Course
-		err := rows.Scan(&c.ID, &c.Title, &c.Description, &c.Lessons, &c.Duration, &c.EnrollLink, &c.Category, pq.Array(&c.Tags), &c.Image, &c.CreatedAt, &c.UpdatedAt)
+		c, err := scanCourse(rows, locale, now)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
-		
-		// Fallback for missing image
-		if c.Image == "" {
-			c.Image = "/images/service-1.png"
-		}
-		
 		courses = append(courses, c)
 	}
 
+	urls := make([]string, len(courses))
+	for i := range courses {
+		urls[i] = courses[i].Image
+	}
+	sets, err := loadImageSets(urls)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	for i := range courses {
+		courses[i].ImageSet = sets[courses[i].Image]
+	}
+
+	if err := translateCourses(locale, courses); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	for i := range courses {
+		courses[i].applyTotals(locale)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(courses)
 }
 
+// getCourse returns one course with its modules and lessons
+func (s *Server) getCourse(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	c, err := scanCourse(db.QueryRow("SELECT "+courseColumns+" FROM courses WHERE id=$1 AND deleted_at IS NULL", id), locale, time.Now())
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	sets, err := loadImageSets([]string{c.Image})
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	c.ImageSet = sets[c.Image]
+
+	courses := []Course{c}
+	if err := translateCourses(locale, courses); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	c = courses[0]
+	c.applyTotals(locale)
+
+	if c.Modules, err = loadCourseModules(id); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
 func (s *Server) createCourse(w http.ResponseWriter, r *http.Request) {
 	var c Course
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if errs := validateCourse(&c); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
 		return
 	}
+	defer tx.Rollback()
 
-	err := db.QueryRow(
-		"INSERT INTO courses (title, description, lessons, duration, price, category, tags, image) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at",
-		c.Title, c.Description, c.Lessons, c.Duration, c.EnrollLink, c.Category, pq.Array(c.Tags), c.Image,
+	errs := FieldErrors{}
+	if err := resolveCategory(tx, "course", &c.CategoryID, &c.Category, errs); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	err = tx.QueryRow(
+		"INSERT INTO courses (title, description, lessons, duration, enroll_link, category, category_id, tags, image, enrollment_open, capacity, "+pricingColumns+") "+
+			"VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::uuid, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id, created_at, updated_at",
+		append([]interface{}{c.Title, c.Description, c.Lessons, c.Duration, c.EnrollLink, c.Category, c.CategoryID, pq.Array(c.Tags), c.Image, c.EnrollmentOpen, c.Capacity}, pricingArgs(c.Pricing)...)...,
 	).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+
+	if _, err := saveRevision(tx, r, courseRevisions, c.ID, 0); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course", "courses", c.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	c.Pricing.localize(defaultLocale(), time.Now())
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(c)
@@ -190,21 +654,77 @@ func (s *Server) updateCourse(w http.ResponseWriter, r *http.Request) {
 	id := params["id"]
 
 	var c Course
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if errs := validateCourse(&c); len(errs) > 0 {
+		writeValidationError(w, errs)
 		return
 	}
 
-	_, err := db.Exec(
-		"UPDATE courses SET title=$1, description=$2, lessons=$3, duration=$4, price=$5, category=$6, tags=$7, image=$8, updated_at=CURRENT_TIMESTAMP WHERE id=$9",
-		c.Title, c.Description, c.Lessons, c.Duration, c.EnrollLink, c.Category, pq.Array(c.Tags), c.Image, id,
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	errs := FieldErrors{}
+	if err := resolveCategory(tx, "course", &c.CategoryID, &c.Category, errs); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	before, err := snapshotRow(tx, "courses", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec(
+		"UPDATE courses SET title=$1, description=$2, lessons=$3, duration=$4, enroll_link=$5, category=$6, category_id=NULLIF($10, '')::uuid, tags=$7, image=$8, enrollment_open=$11, capacity=$12, "+
+			"price_free=$13, price_amount=$14, price_currency=$15, discount_amount=$16, discount_starts_at=$17, discount_ends_at=$18, updated_at=CURRENT_TIMESTAMP WHERE id=$9 AND deleted_at IS NULL",
+		append([]interface{}{c.Title, c.Description, c.Lessons, c.Duration, c.EnrollLink, c.Category, pq.Array(c.Tags), c.Image, id, c.CategoryID, c.EnrollmentOpen, c.Capacity}, pricingArgs(c.Pricing)...)...,
 	)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if _, err := saveRevision(tx, r, courseRevisions, id, 0); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course", "courses", id, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// A raised or removed capacity lets the waitlist in
+	promoted, err := promoteWaitlist(tx, r, id)
+	if err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if len(promoted) > 0 {
+		wakeOutbox()
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -212,9 +732,36 @@ func (s *Server) deleteCourse(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
-	_, err := db.Exec("DELETE FROM courses WHERE id=$1", id)
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "courses", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("UPDATE courses SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "course", "courses", id, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -224,9 +771,21 @@ func (s *Server) deleteCourse(w http.ResponseWriter, r *http.Request) {
 // Category Handlers
 
 func (s *Server) getCategories(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, name, type, sort_order FROM categories ORDER BY sort_order ASC, created_at ASC")
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT c.id, c.name, c.type, c.sort_order,
+			CASE c.type
+				WHEN 'blog' THEN (SELECT COUNT(*) FROM articles a WHERE a.category_id = c.id AND ` + publishedArticleFilter + `)
+				ELSE (SELECT COUNT(*) FROM courses co WHERE co.category_id = c.id AND co.deleted_at IS NULL)
+			END
+		FROM categories c WHERE c.deleted_at IS NULL ORDER BY c.sort_order ASC, c.created_at ASC`,
+	)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 	defer rows.Close()
@@ -234,32 +793,65 @@ func (s *Server) getCategories(w http.ResponseWriter, r *http.Request) {
 	categories := []Category{}
 	for rows.Next() {
 		var c Category
-		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.SortOrder)
+		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.SortOrder, &c.Count)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
 		categories = append(categories, c)
 	}
 
+	if err := translateCategories(locale, categories); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(categories)
 }
 
-func (s *Server) createCategory(w http.ResponseWriter, r *http.Request) {
-	var c Category
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+func (s *Server) createCategory(w http.ResponseWriter, r *http.Request) {
+	var c Category
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if errs := validateCategory(&c); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if taken, err := categoryNameTaken(tx, c.Name, c.Type, ""); err != nil {
+		writeInternalError(w, err)
+		return
+	} else if taken {
+		writeError(w, http.StatusConflict, "A "+c.Type+" category with this name already exists")
 		return
 	}
 
-	err := db.QueryRow(
+	err = tx.QueryRow(
 		"INSERT INTO categories (name, type, sort_order) VALUES ($1, $2, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM categories)) RETURNING id",
 		c.Name, c.Type,
 	).Scan(&c.ID)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "category", "categories", c.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -270,28 +862,47 @@ func (s *Server) createCategory(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) reorderCategories(w http.ResponseWriter, r *http.Request) {
 	var categoryIDs []string
-	if err := json.NewDecoder(r.Body).Decode(&categoryIDs); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &categoryIDs) {
+		return
+	}
+	if errs := validateIDList(categoryIDs); len(errs) > 0 {
+		writeValidationError(w, errs)
 		return
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 	defer tx.Rollback()
 
+	before, err := snapshotOrder(tx, "categories")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	for i, id := range categoryIDs {
 		_, err := tx.Exec("UPDATE categories SET sort_order = $1 WHERE id = $2", i, id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
 	}
 
+	after, err := snapshotOrder(tx, "categories")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if err := auditReorder(tx, r, "category", before, after); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 
@@ -303,18 +914,81 @@ func (s *Server) updateCategory(w http.ResponseWriter, r *http.Request) {
 	id := params["id"]
 
 	var c Category
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if errs := validateCategory(&c); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
 		return
 	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "categories", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if taken, err := categoryNameTaken(tx, c.Name, c.Type, id); err != nil {
+		writeInternalError(w, err)
+		return
+	} else if taken {
+		writeError(w, http.StatusConflict, "A "+c.Type+" category with this name already exists")
+		return
+	}
+
+	// Content keeps pointing at the category, so its type can only change while it is unused
+	if oldType, _ := before["type"].(string); oldType != "" && oldType != c.Type {
+		n, err := countCategoryUse(tx, oldType, id, true)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if n > 0 {
+			writeError(w, http.StatusConflict, categoryInUseMessage(oldType, n, "its type cannot change"))
+			return
+		}
+	}
 
-	_, err := db.Exec(
-		"UPDATE categories SET name=$1, type=$2 WHERE id=$3",
+	res, err := tx.Exec(
+		"UPDATE categories SET name=$1, type=$2 WHERE id=$3 AND deleted_at IS NULL",
 		c.Name, c.Type, id,
 	)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	// Content carries a copy of the name for filtering and feeds. Bumping updated_at
+	// changes the feed ETag, so cached feeds pick up the new name.
+	for _, content := range categoryContents {
+		if _, err := tx.Exec(
+			"UPDATE "+content.table+" SET category=$1, updated_at=CURRENT_TIMESTAMP WHERE category_id=$2 AND category<>$1",
+			c.Name, id,
+		); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if err := auditRowChange(tx, r, "category", "categories", id, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -325,9 +999,84 @@ func (s *Server) deleteCategory(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
-	_, err := db.Exec("DELETE FROM categories WHERE id=$1", id)
+	// Content still filed under the category blocks the delete unless it is moved to ?reassignTo
+	reassignTo := r.URL.Query().Get("reassignTo")
+	if reassignTo != "" && !isUUID(reassignTo) {
+		writeAPIError(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidID, Message: "Invalid reassignTo: expected a UUID"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "categories", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if before == nil || before["deleted_at"] != nil {
+		writeError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+	categoryType, _ := before["type"].(string)
+	name, _ := before["name"].(string)
+
+	if reassignTo != "" {
+		var targetName, targetType string
+		err := tx.QueryRow("SELECT name, type FROM categories WHERE id=$1 AND deleted_at IS NULL", reassignTo).Scan(&targetName, &targetType)
+		if err != nil && err != sql.ErrNoRows {
+			writeInternalError(w, err)
+			return
+		}
+		errs := FieldErrors{}
+		if reassignTo == id {
+			errs.add("reassignTo", "must be a different category")
+		} else if err == sql.ErrNoRows {
+			errs.add("reassignTo", "is not an existing category")
+		} else if targetType != categoryType {
+			errs.add("reassignTo", "must be a "+categoryType+" category")
+		}
+		if len(errs) > 0 {
+			writeValidationError(w, errs)
+			return
+		}
+		if err := reassignCategory(tx, r, categoryType, id, name, reassignTo, targetName); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	} else {
+		n, err := countCategoryUse(tx, categoryType, id, false)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if n > 0 {
+			writeError(w, http.StatusConflict, categoryInUseMessage(categoryType, n, "move them with ?reassignTo=<categoryId>"))
+			return
+		}
+	}
+
+	res, err := tx.Exec("UPDATE categories SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "category", "categories", id, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -337,9 +1086,14 @@ func (s *Server) deleteCategory(w http.ResponseWriter, r *http.Request) {
 // Project Handlers
 
 func (s *Server) getProjects(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, title, COALESCE(description, ''), COALESCE(detail, ''), COALESCE(link_label, ''), COALESCE(link_href, ''), COALESCE(image, ''), sort_order, created_at, updated_at FROM projects ORDER BY sort_order ASC, created_at DESC")
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query("SELECT id, title, COALESCE(description, ''), COALESCE(detail, ''), COALESCE(link_label, ''), COALESCE(link_href, ''), COALESCE(image, ''), sort_order, created_at, updated_at FROM projects WHERE deleted_at IS NULL ORDER BY sort_order ASC, created_at DESC")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 	defer rows.Close()
@@ -349,7 +1103,7 @@ func (s *Server) getProjects(w http.ResponseWriter, r *http.Request) {
 		var p Project
 		err := rows.Scan(&p.ID, &p.Title, &p.Description, &p.Detail, &p.LinkLabel, &p.LinkHref, &p.Image, &p.SortOrder, &p.CreatedAt, &p.UpdatedAt)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
 		
@@ -361,24 +1115,62 @@ func (s *Server) getProjects(w http.ResponseWriter, r *http.Request) {
 		projects = append(projects, p)
 	}
 
+	urls := make([]string, len(projects))
+	for i := range projects {
+		urls[i] = projects[i].Image
+	}
+	sets, err := loadImageSets(urls)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	for i := range projects {
+		projects[i].ImageSet = sets[projects[i].Image]
+	}
+
+	if err := translateProjects(locale, projects); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(projects)
 }
 
 func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 	var p Project
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &p) {
+		return
+	}
+	if errs := validateProject(&p); len(errs) > 0 {
+		writeValidationError(w, errs)
 		return
 	}
 
-	err := db.QueryRow(
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
 		"INSERT INTO projects (title, description, detail, link_label, link_href, image, sort_order) VALUES ($1, $2, $3, $4, $5, $6, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM projects)) RETURNING id, created_at, updated_at",
 		p.Title, p.Description, p.Detail, p.LinkLabel, p.LinkHref, p.Image,
 	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "project", "projects", p.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -392,18 +1184,48 @@ func (s *Server) updateProject(w http.ResponseWriter, r *http.Request) {
 	id := params["id"]
 
 	var p Project
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &p) {
+		return
+	}
+	if errs := validateProject(&p); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "projects", id)
+	if err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
-	_, err := db.Exec(
-		"UPDATE projects SET title=$1, description=$2, detail=$3, link_label=$4, link_href=$5, image=$6, updated_at=CURRENT_TIMESTAMP WHERE id=$7",
+	res, err := tx.Exec(
+		"UPDATE projects SET title=$1, description=$2, detail=$3, link_label=$4, link_href=$5, image=$6, updated_at=CURRENT_TIMESTAMP WHERE id=$7 AND deleted_at IS NULL",
 		p.Title, p.Description, p.Detail, p.LinkLabel, p.LinkHref, p.Image, id,
 	)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "project", "projects", id, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -414,9 +1236,36 @@ func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
-	_, err := db.Exec("DELETE FROM projects WHERE id=$1", id)
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "projects", id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("UPDATE projects SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "project", "projects", id, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -425,28 +1274,47 @@ func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) reorderProjects(w http.ResponseWriter, r *http.Request) {
 	var projectIDs []string
-	if err := json.NewDecoder(r.Body).Decode(&projectIDs); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &projectIDs) {
+		return
+	}
+	if errs := validateIDList(projectIDs); len(errs) > 0 {
+		writeValidationError(w, errs)
 		return
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 	defer tx.Rollback()
 
+	before, err := snapshotOrder(tx, "projects")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	for i, id := range projectIDs {
 		_, err := tx.Exec("UPDATE projects SET sort_order = $1 WHERE id = $2", i, id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
 	}
 
+	after, err := snapshotOrder(tx, "projects")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if err := auditReorder(tx, r, "project", before, after); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 
@@ -456,9 +1324,14 @@ func (s *Server) reorderProjects(w http.ResponseWriter, r *http.Request) {
 // Certificate Handlers
 
 func (s *Server) getCertificates(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, title, issuer, year, COALESCE(image, ''), sort_order, created_at, updated_at FROM certificates ORDER BY sort_order ASC, created_at DESC")
+	locale, ok := negotiateLocale(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query("SELECT id, title, issuer, year, COALESCE(image, ''), sort_order, created_at, updated_at FROM certificates WHERE deleted_at IS NULL ORDER BY sort_order ASC, created_at DESC")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 	defer rows.Close()
@@ -468,7 +1341,7 @@ func (s *Server) getCertificates(w http.ResponseWriter, r *http.Request) {
 		var c Certificate
 		err := rows.Scan(&c.ID, &c.Title, &c.Issuer, &c.Year, &c.Image, &c.SortOrder, &c.CreatedAt, &c.UpdatedAt)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
 
@@ -480,24 +1353,62 @@ func (s *Server) getCertificates(w http.ResponseWriter, r *http.Request) {
 		certificates = append(certificates, c)
 	}
 
+	urls := make([]string, len(certificates))
+	for i := range certificates {
+		urls[i] = certificates[i].Image
+	}
+	sets, err := loadImageSets(urls)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	for i := range certificates {
+		certificates[i].ImageSet = sets[certificates[i].Image]
+	}
+
+	if err := translateCertificates(locale, certificates); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(certificates)
 }
 
 func (s *Server) createCertificate(w http.ResponseWriter, r *http.Request) {
 	var c Certificate
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if errs := validateCertificate(&c); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
 		return
 	}
+	defer tx.Rollback()
 
-	err := db.QueryRow(
+	err = tx.QueryRow(
 		"INSERT INTO certificates (title, issuer, year, image, sort_order) VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM certificates)) RETURNING id, created_at, updated_at",
 		c.Title, c.Issuer, c.Year, c.Image,
 	).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "certificate", "certificates", c.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -511,18 +1422,48 @@ func (s *Server) updateCertificate(w http.ResponseWriter, r *http.Request) {
 	id := params["id"]
 
 	var c Certificate
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+	if errs := validateCertificate(&c); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "certificates", id)
+	if err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
-	_, err := db.Exec(
-		"UPDATE certificates SET title=$1, issuer=$2, year=$3, image=$4, updated_at=CURRENT_TIMESTAMP WHERE id=$5",
+	res, err := tx.Exec(
+		"UPDATE certificates SET title=$1, issuer=$2, year=$3, image=$4, updated_at=CURRENT_TIMESTAMP WHERE id=$5 AND deleted_at IS NULL",
 		c.Title, c.Issuer, c.Year, c.Image, id,
 	)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Certificate not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "certificate", "certificates", id, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -533,9 +1474,36 @@ func (s *Server) deleteCertificate(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
-	_, err := db.Exec("DELETE FROM certificates WHERE id=$1", id)
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "certificates", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("UPDATE certificates SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Certificate not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "certificate", "certificates", id, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
 		return
 	}
 
@@ -544,28 +1512,47 @@ func (s *Server) deleteCertificate(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) reorderCertificates(w http.ResponseWriter, r *http.Request) {
 	var certIDs []string
-	if err := json.NewDecoder(r.Body).Decode(&certIDs); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &certIDs) {
+		return
+	}
+	if errs := validateIDList(certIDs); len(errs) > 0 {
+		writeValidationError(w, errs)
 		return
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 	defer tx.Rollback()
 
+	before, err := snapshotOrder(tx, "certificates")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	for i, id := range certIDs {
 		_, err := tx.Exec("UPDATE certificates SET sort_order = $1 WHERE id = $2", i, id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, err)
 			return
 		}
 	}
 
+	after, err := snapshotOrder(tx, "certificates")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if err := auditReorder(tx, r, "certificate", before, after); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// stripImageMetadata removes EXIF (including GPS), XMP, IPTC and text metadata from an
+// uploaded image without re-encoding it. JPEG orientation is kept so photos still display
+// upright. Files that cannot be parsed are returned unchanged.
+func stripImageMetadata(data []byte, contentType string) []byte {
+	var out []byte
+	var ok bool
+	switch contentType {
+	case "image/jpeg":
+		out, ok = stripJPEGMetadata(data)
+	case "image/png":
+		out, ok = stripPNGMetadata(data)
+	case "image/webp":
+		out, ok = stripWebPMetadata(data)
+	}
+	if !ok {
+		return data
+	}
+	return out
+}
+
+func stripJPEGMetadata(data []byte) ([]byte, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, false
+	}
+
+	orientation := jpegOrientation(data)
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	needOrientation := orientation > 1
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, false
+		}
+		marker := data[i+1]
+
+		// The orientation goes right after the JFIF header, where EXIF normally sits
+		if needOrientation && marker != 0xE0 {
+			out.Write(minimalEXIF(orientation))
+			needOrientation = false
+		}
+
+		// Start of scan: the rest is image data
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), true
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, false
+		}
+
+		// APP1 (EXIF/XMP), APP13 (IPTC) and comments are dropped
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return nil, false
+}
+
+// minimalEXIF builds an APP1 segment holding only the orientation tag
+func minimalEXIF(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // big-endian header, IFD0 at offset 8
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, // Orientation, SHORT, count 1
+		0x00, byte(orientation), 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, 1 when absent
+func jpegOrientation(data []byte) int {
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			if o := tiffOrientation(data[i+10 : end]); o > 0 {
+				return o
+			}
+		}
+		i = end
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for e := 0; e < count; e++ {
+		off := ifd + 2 + e*12
+		if off+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[off:off+2]) == 0x0112 {
+			o := int(order.Uint16(tiff[off+8 : off+10]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNGMetadata(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, false
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+
+	i := len(pngSignature)
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, false
+		}
+
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+			// dropped
+		default:
+			out.Write(data[i:end])
+		}
+
+		if string(data[i+4:i+8]) == "IEND" {
+			return out.Bytes(), true
+		}
+		i = end
+	}
+	return nil, false
+}
+
+func stripWebPMetadata(data []byte) ([]byte, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+
+	vp8xFlags := -1
+	i := 12
+	for i+8 <= len(data) {
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2 // chunks are padded to an even size
+		if end > len(data) {
+			return nil, false
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+			// dropped
+		default:
+			if fourCC == "VP8X" {
+				vp8xFlags = body.Len() + 8
+			}
+			body.Write(data[i:end])
+		}
+		i = end
+	}
+
+	out := body.Bytes()
+	if vp8xFlags >= 0 && vp8xFlags < len(out) {
+		out[vp8xFlags] &^= 0x04 | 0x08 // clear the EXIF and XMP flags
+	}
+
+	header := make([]byte, 8)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(out)))
+	return append(header, out...), true
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+const secret = "GPS 50.4501N 30.5234E"
+
+func testImage() image.Image {
+	return image.NewRGBA(image.Rect(0, 0, 4, 2))
+}
+
+// jpegSegment builds a JPEG marker segment with the given payload
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// exifWithOrientation is an APP1 payload with the orientation tag followed by other data
+func exifWithOrientation(orientation int, order string) []byte {
+	tiff := []byte(order)
+	if order == "II" {
+		tiff = append(tiff, 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00, 0x01, 0x00,
+			0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, byte(orientation), 0x00, 0x00, 0x00)
+	} else {
+		tiff = append(tiff, 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, 0x00, 0x01,
+			0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, byte(orientation), 0x00, 0x00)
+	}
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, secret...)
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+func encodeJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...) // SOI
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	tests := []struct {
+		name            string
+		segments        [][]byte
+		wantOrientation int
+	}{
+		{"no metadata", nil, 1},
+		{"EXIF big-endian, rotated", [][]byte{jpegSegment(0xE1, exifWithOrientation(6, "MM"))}, 6},
+		{"EXIF little-endian, rotated", [][]byte{jpegSegment(0xE1, exifWithOrientation(8, "II"))}, 8},
+		{"EXIF upright", [][]byte{jpegSegment(0xE1, exifWithOrientation(1, "MM"))}, 1},
+		{"XMP, IPTC and a comment", [][]byte{
+			jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"+secret)),
+			jpegSegment(0xED, []byte("Photoshop 3.0\x00"+secret)),
+			jpegSegment(0xFE, []byte(secret)),
+		}, 1},
+		{"JFIF header is kept", [][]byte{
+			jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")),
+			jpegSegment(0xE1, exifWithOrientation(3, "MM")),
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := stripImageMetadata(encodeJPEG(t, tt.segments...), "image/jpeg")
+
+			if bytes.Contains(out, []byte(secret)) {
+				t.Error("metadata survived stripping")
+			}
+			if got := jpegOrientation(out); got != tt.wantOrientation {
+				t.Errorf("orientation = %d, want %d", got, tt.wantOrientation)
+			}
+			if tt.wantOrientation == 1 && bytes.Contains(out, []byte("Exif\x00\x00")) {
+				t.Error("upright image still has an EXIF segment")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+				t.Errorf("stripped JPEG does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func pngChunk(kind string, payload []byte) []byte {
+	chunk := make([]byte, 8, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, payload...)
+	return append(chunk, 0, 0, 0, 0) // the CRC of dropped chunks is never checked
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	iend := bytes.Index(data, []byte("IEND")) - 4
+
+	var in []byte
+	in = append(in, data[:iend]...)
+	for _, kind := range []string{"tEXt", "zTXt", "iTXt", "eXIf", "tIME"} {
+		in = append(in, pngChunk(kind, []byte(secret))...)
+	}
+	in = append(in, data[iend:]...)
+
+	out := stripImageMetadata(in, "image/png")
+	if bytes.Contains(out, []byte(secret)) {
+		t.Error("metadata survived stripping")
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("stripped PNG differs from the original: %d bytes, want %d", len(out), len(data))
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stripped PNG does not decode: %v", err)
+	}
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := make([]byte, 8, 9+len(payload))
+	copy(chunk, fourCC)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x04 | 0x08 | 0x10 // EXIF, XMP and alpha
+
+	var body []byte
+	body = append(body, "WEBP"...)
+	body = append(body, webpChunk("VP8X", vp8x)...)
+	body = append(body, webpChunk("VP8L", []byte{0x2F, 1, 2, 3, 4})...)
+	body = append(body, webpChunk("EXIF", []byte(secret))...)
+	body = append(body, webpChunk("XMP ", []byte(secret))...)
+	in := append([]byte("RIFF\x00\x00\x00\x00"), body...)
+	binary.LittleEndian.PutUint32(in[4:], uint32(len(body)))
+
+	out := stripImageMetadata(in, "image/webp")
+	if bytes.Contains(out, []byte(secret)) || bytes.Contains(out, []byte("EXIF")) || bytes.Contains(out, []byte("XMP ")) {
+		t.Error("metadata survived stripping")
+	}
+	if size := int(binary.LittleEndian.Uint32(out[4:8])); size != len(out)-8 {
+		t.Errorf("RIFF size = %d, want %d", size, len(out)-8)
+	}
+	flags := out[20]
+	if flags&(0x04|0x08) != 0 || flags&0x10 == 0 {
+		t.Errorf("VP8X flags = %#x, want only alpha left", flags)
+	}
+}
+
+func TestStripImageMetadataLeavesUnparsableFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+	}{
+		{"truncated JPEG", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10, 0x00, 'E'}, "image/jpeg"},
+		{"not a PNG", []byte("GIF89a"), "image/png"},
+		{"PNG without IEND", append(append([]byte{}, pngSignature...), pngChunk("tEXt", []byte(secret))...), "image/png"},
+		{"short WebP", []byte("RIFF\x00\x00"), "image/webp"},
+		{"GIF is passed through", []byte("GIF89a" + secret), "image/gif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := stripImageMetadata(tt.data, tt.contentType); !bytes.Equal(out, tt.data) {
+				t.Errorf("got %q, want the input unchanged", out)
+			}
+		})
+	}
+}
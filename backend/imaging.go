@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gen2brain/webp"
+	"github.com/lib/pq"
+	"golang.org/x/image/draw"
+)
+
+const (
+	thumbnailSize      = 200
+	variantJPEGQuality = 82
+	variantWebPQuality = 80
+
+	// Larger images are rejected before decoding to keep memory bounded
+	maxProcessPixels = 50_000_000
+
+	mediaQueueSize     = 100
+	mediaSweepInterval = time.Minute
+)
+
+// Widths of the responsive variants; an image is never upscaled
+var variantWidths = []int{320, 640, 1280}
+
+var variantFormats = []string{"webp", "jpeg"}
+
+// ImageSet describes the generated variants of an entity's image
+type ImageSet struct {
+	Srcset     string `json:"srcset"`
+	SrcsetWebp string `json:"srcsetWebp"`
+	Thumbnail  string `json:"thumbnail,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+}
+
+// loadImageSets returns the image sets of processed media, keyed by media URL.
+// URLs that are not in the media library are simply absent from the map.
+func loadImageSets(urls []string) (map[string]*ImageSet, error) {
+	sets := map[string]*ImageSet{}
+	if len(urls) == 0 {
+		return sets, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT m.url, COALESCE(m.width, 0), COALESCE(m.height, 0), v.kind, v.format, v.width, v.url
+		FROM media m
+		JOIN media_variants v ON v.media_id = m.id
+		WHERE m.url = ANY($1) AND m.processing_status = 'ready'
+		ORDER BY m.url, v.kind, v.format, v.width`,
+		pq.Array(urls),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaURL, kind, format, variantURL string
+		var width, height, variantWidth int
+		if err := rows.Scan(&mediaURL, &width, &height, &kind, &format, &variantWidth, &variantURL); err != nil {
+			return nil, err
+		}
+
+		set, ok := sets[mediaURL]
+		if !ok {
+			set = &ImageSet{Width: width, Height: height}
+			sets[mediaURL] = set
+		}
+
+		switch {
+		case kind == "thumbnail":
+			// Prefer the WebP thumbnail, every current browser supports it
+			if set.Thumbnail == "" || format == "webp" {
+				set.Thumbnail = variantURL
+			}
+		case format == "webp":
+			set.SrcsetWebp = appendSrcset(set.SrcsetWebp, variantURL, variantWidth)
+		default:
+			set.Srcset = appendSrcset(set.Srcset, variantURL, variantWidth)
+		}
+	}
+	return sets, rows.Err()
+}
+
+// attachArticleImageSet fills in the image set of a single article
+func attachArticleImageSet(a *Article) error {
+	sets, err := loadImageSets([]string{a.Image})
+	if err != nil {
+		return err
+	}
+	a.ImageSet = sets[a.Image]
+	return nil
+}
+
+func appendSrcset(srcset, url string, width int) string {
+	entry := url + " " + strconv.Itoa(width) + "w"
+	if srcset == "" {
+		return entry
+	}
+	return srcset + ", " + entry
+}
+
+// mediaProcessor generates image variants with a fixed number of workers so a burst
+// of uploads queues up instead of competing with request handling for CPU
+type mediaProcessor struct {
+	store   Storage
+	workers int
+	queue   chan string
+}
+
+func newMediaProcessor(store Storage) *mediaProcessor {
+	workers := runtime.NumCPU() / 2
+	if v := os.Getenv("MEDIA_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			workers = n
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return &mediaProcessor{store: store, workers: workers, queue: make(chan string, mediaQueueSize)}
+}
+
+// Start launches the workers and a sweeper that picks up media left pending, e.g.
+// because the queue was full or the server restarted mid-way
+func (p *mediaProcessor) Start(ctx context.Context) {
+	// Work interrupted by a restart is started over
+	if _, err := db.Exec("UPDATE media SET processing_status='pending' WHERE processing_status='processing'"); err != nil {
+		log.Printf("Error resetting media processing: %v", err)
+	}
+
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-p.queue:
+					p.process(ctx, id)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(mediaSweepInterval)
+		defer ticker.Stop()
+		for {
+			p.sweep()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Enqueue schedules a media item for processing without blocking. When the queue is
+// full the item stays pending and the sweeper gets to it later.
+func (p *mediaProcessor) Enqueue(id string) {
+	select {
+	case p.queue <- id:
+	default:
+	}
+}
+
+func (p *mediaProcessor) sweep() {
+	rows, err := db.Query("SELECT id FROM media WHERE processing_status='pending' ORDER BY created_at LIMIT $1", mediaQueueSize)
+	if err != nil {
+		log.Printf("Error listing pending media: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("Error listing pending media: %v", err)
+			return
+		}
+		p.Enqueue(id)
+	}
+}
+
+func (p *mediaProcessor) process(ctx context.Context, id string) {
+	// Claiming the row keeps a sweep from processing the same media twice
+	var key, contentType string
+	err := db.QueryRow(
+		"UPDATE media SET processing_status='processing', processing_error=NULL WHERE id=$1 AND processing_status='pending' RETURNING storage_key, content_type",
+		id,
+	).Scan(&key, &contentType)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error claiming media %s: %v", id, err)
+		}
+		return
+	}
+
+	status, message := "ready", ""
+	if err := p.generateVariants(ctx, id, key, contentType); err != nil {
+		log.Printf("Error processing media %s: %v", id, err)
+		status, message = "failed", err.Error()
+	}
+
+	if _, err := db.Exec("UPDATE media SET processing_status=$1, processing_error=NULLIF($2, '') WHERE id=$3", status, message, id); err != nil {
+		log.Printf("Error updating media %s: %v", id, err)
+	}
+}
+
+func (p *mediaProcessor) generateVariants(ctx context.Context, id, key, contentType string) error {
+	f, err := p.store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if cfg.Width*cfg.Height > maxProcessPixels {
+		return fmt.Errorf("image is too large to process (%dx%d)", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if contentType == "image/jpeg" {
+		img = orientImage(img, jpegOrientation(data))
+	}
+
+	base := strings.TrimSuffix(key, path.Ext(key))
+	srcWidth := img.Bounds().Dx()
+
+	for _, width := range variantWidths {
+		if width > srcWidth {
+			width = srcWidth
+		}
+		resized := resizeToWidth(img, width)
+		for _, format := range variantFormats {
+			variantKey := fmt.Sprintf("%s-%dw.%s", base, width, variantExt(format))
+			if err := p.storeVariant(ctx, id, "responsive", format, variantKey, resized); err != nil {
+				return err
+			}
+		}
+		if width == srcWidth {
+			break
+		}
+	}
+
+	thumb := cropThumbnail(img, thumbnailSize)
+	for _, format := range variantFormats {
+		variantKey := fmt.Sprintf("%s-thumb.%s", base, variantExt(format))
+		if err := p.storeVariant(ctx, id, "thumbnail", format, variantKey, thumb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *mediaProcessor) storeVariant(ctx context.Context, mediaID, kind, format, key string, img image.Image) error {
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case "webp":
+		contentType = "image/webp"
+		if err := webp.Encode(&buf, img, webp.Options{Quality: variantWebPQuality}); err != nil {
+			return err
+		}
+	default:
+		contentType = "image/jpeg"
+		if err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: variantJPEGQuality}); err != nil {
+			return err
+		}
+	}
+
+	size := int64(buf.Len())
+	if err := p.store.Put(ctx, key, &buf, size, contentType); err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	_, err := db.Exec(
+		`INSERT INTO media_variants (media_id, kind, format, width, height, storage_key, url, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (media_id, kind, format, width) DO UPDATE SET height=EXCLUDED.height, storage_key=EXCLUDED.storage_key, url=EXCLUDED.url, size_bytes=EXCLUDED.size_bytes`,
+		mediaID, kind, format, b.Dx(), b.Dy(), key, p.store.URL(key), size,
+	)
+	return err
+}
+
+func variantExt(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+func resizeToWidth(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if width == b.Dx() {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// cropThumbnail scales the centre square of img to size x size
+func cropThumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	if side < size {
+		size = side
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x, y, x+side, y+side), draw.Src, nil)
+	return dst
+}
+
+// flatten composites img onto white, since JPEG has no transparency
+func flatten(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// orientImage applies an EXIF orientation (2-8) so the pixels are stored upright
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
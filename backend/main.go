@@ -6,7 +6,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	firebase "firebase.google.com/go/v4"
@@ -19,6 +21,8 @@ import (
 
 type Server struct {
 	authClient *auth.Client
+	media      Storage
+	processor  *mediaProcessor
 }
 
 func main() {
@@ -28,9 +32,31 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	// Subcommand: server migrate up|down [steps]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		openDB()
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
 	// Initialize Database
 	initDB()
 
+	// Publish scheduled articles and empty the trash in the background
+	go runSchedulePublisher(context.Background())
+	go runTrashPurger(context.Background())
+
+	// Send queued email in the background; it is drained on shutdown after the HTTP server
+	mailer, err := newMailerFromEnv()
+	if err != nil {
+		log.Fatalf("error initializing mailer: %v\n", err)
+	}
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	outbox := newOutboxWorker(mailer)
+	go outbox.Run(outboxCtx)
+
 	// Initialize Firebase
 	ctx := context.Background()
 	opt := option.WithCredentialsFile("serviceAccountKey.json")
@@ -44,13 +70,27 @@ func main() {
 		log.Fatalf("error getting Auth client: %v\n", err)
 	}
 
+	media, err := newStorageFromEnv()
+	if err != nil {
+		log.Fatalf("error initializing media storage: %v\n", err)
+	}
+
+	// Generate image variants in the background
+	processor := newMediaProcessor(media)
+	processor.Start(context.Background())
+
 	s := &Server{
 		authClient: authClient,
+		media:      media,
+		processor:  processor,
 	}
 
 	// Setup Router
 	r := mux.NewRouter()
 	api := r.PathPrefix("/api").Subrouter()
+	api.Use(validateIDParam)
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
 
 	// Public Routes
 	api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -60,10 +100,13 @@ func main() {
 
 	// Articles
 	api.HandleFunc("/articles", s.getArticles).Methods("GET")
+	api.HandleFunc("/articles/by-slug/{slug}", s.getArticleBySlug).Methods("GET")
 	api.HandleFunc("/articles/{id}", s.getArticle).Methods("GET")
 	
 	// Courses
 	api.HandleFunc("/courses", s.getCourses).Methods("GET")
+	api.HandleFunc("/courses/{id}", s.getCourse).Methods("GET")
+	api.HandleFunc("/courses/{id}/enroll", s.enrollInCourse).Methods("POST")
 	
 	// Categories
 	api.HandleFunc("/categories", s.getCategories).Methods("GET")
@@ -74,43 +117,111 @@ func main() {
 	// Certificates
 	api.HandleFunc("/certificates", s.getCertificates).Methods("GET")
 
+	// Feeds
+	api.HandleFunc("/feed.xml", s.getRSSFeed).Methods("GET")
+	api.HandleFunc("/atom.xml", s.getAtomFeed).Methods("GET")
+	api.HandleFunc("/feed.json", s.getJSONFeed).Methods("GET")
+
+	// Search
+	api.HandleFunc("/search", s.handleSearch).Methods("GET")
+
 	// Contact
 	api.HandleFunc("/contact", s.handleContact).Methods("POST")
 
+	// Uploaded media (local storage only, S3 serves its own files)
+	if local, ok := media.(*LocalStorage); ok {
+		r.PathPrefix("/media/").Handler(http.StripPrefix("/media/", local.Handler()))
+	}
+
 	// Admin Routes (Protected)
 	admin := api.NewRoute().Subrouter()
 	admin.Use(s.AuthMiddleware)
 
 	// Auth check
 	api.HandleFunc("/auth/verify", s.verifyToken).Methods("POST")
+	admin.HandleFunc("/auth/me", s.getCurrentAdmin).Methods("GET")
 	
 	// Articles Admin
-	admin.HandleFunc("/articles", s.createArticle).Methods("POST")
-	admin.HandleFunc("/articles/{id}", s.updateArticle).Methods("PUT")
-	admin.HandleFunc("/articles/{id}", s.deleteArticle).Methods("DELETE")
+	admin.HandleFunc("/articles", s.requirePermission(PermArticlesWrite, s.createArticle)).Methods("POST")
+	admin.HandleFunc("/articles/{id}", s.requirePermission(PermArticlesWrite, s.updateArticle)).Methods("PUT")
+	admin.HandleFunc("/articles/{id}", s.requirePermission(PermArticlesWrite, s.deleteArticle)).Methods("DELETE")
+	admin.HandleFunc("/admin/articles", s.requirePermission(PermContentRead, s.getArticles)).Methods("GET")
+	admin.HandleFunc("/admin/articles/{id}", s.requirePermission(PermContentRead, s.getArticle)).Methods("GET")
+	admin.HandleFunc("/admin/articles/{id}/revisions", s.requirePermission(PermContentRead, s.getArticleRevisions)).Methods("GET")
+	admin.HandleFunc("/admin/articles/{id}/revisions/diff", s.requirePermission(PermContentRead, s.diffArticleRevisions)).Methods("GET")
+	admin.HandleFunc("/admin/articles/{id}/revisions/{rev:[0-9]+}", s.requirePermission(PermContentRead, s.getArticleRevision)).Methods("GET")
+	admin.HandleFunc("/admin/articles/{id}/revisions/{rev:[0-9]+}/restore", s.requirePermission(PermArticlesWrite, s.restoreArticleRevision)).Methods("POST")
 
 	// Courses Admin
-	admin.HandleFunc("/courses", s.createCourse).Methods("POST")
-	admin.HandleFunc("/courses/{id}", s.updateCourse).Methods("PUT")
-	admin.HandleFunc("/courses/{id}", s.deleteCourse).Methods("DELETE")
+	admin.HandleFunc("/courses", s.requirePermission(PermContentWrite, s.createCourse)).Methods("POST")
+	admin.HandleFunc("/courses/{id}", s.requirePermission(PermContentWrite, s.updateCourse)).Methods("PUT")
+	admin.HandleFunc("/courses/{id}", s.requirePermission(PermContentWrite, s.deleteCourse)).Methods("DELETE")
+	admin.HandleFunc("/courses/{id}/modules", s.requirePermission(PermContentWrite, s.createCourseModule)).Methods("POST")
+	admin.HandleFunc("/courses/{id}/modules/reorder", s.requirePermission(PermContentWrite, s.reorderCourseModules)).Methods("PUT")
+	admin.HandleFunc("/courses/{id}/modules/{moduleId}", s.requirePermission(PermContentWrite, s.updateCourseModule)).Methods("PUT")
+	admin.HandleFunc("/courses/{id}/modules/{moduleId}", s.requirePermission(PermContentWrite, s.deleteCourseModule)).Methods("DELETE")
+	admin.HandleFunc("/courses/{id}/modules/{moduleId}/lessons", s.requirePermission(PermContentWrite, s.createCourseLesson)).Methods("POST")
+	admin.HandleFunc("/courses/{id}/modules/{moduleId}/lessons/reorder", s.requirePermission(PermContentWrite, s.reorderCourseLessons)).Methods("PUT")
+	admin.HandleFunc("/courses/{id}/lessons/{lessonId}", s.requirePermission(PermContentWrite, s.updateCourseLesson)).Methods("PUT")
+	admin.HandleFunc("/courses/{id}/lessons/{lessonId}", s.requirePermission(PermContentWrite, s.deleteCourseLesson)).Methods("DELETE")
+	admin.HandleFunc("/admin/courses/{id}/enrollments", s.requirePermission(PermContentWrite, s.getEnrollments)).Methods("GET")
+	admin.HandleFunc("/admin/courses/{id}/enrollments/export", s.requirePermission(PermContentWrite, s.exportEnrollments)).Methods("GET")
+	admin.HandleFunc("/admin/courses/{id}/enrollments/{enrollmentId}", s.requirePermission(PermContentWrite, s.cancelEnrollment)).Methods("DELETE")
+	admin.HandleFunc("/admin/courses/{id}/revisions", s.requirePermission(PermContentRead, s.getCourseRevisions)).Methods("GET")
+	admin.HandleFunc("/admin/courses/{id}/revisions/diff", s.requirePermission(PermContentRead, s.diffCourseRevisions)).Methods("GET")
+	admin.HandleFunc("/admin/courses/{id}/revisions/{rev:[0-9]+}", s.requirePermission(PermContentRead, s.getCourseRevision)).Methods("GET")
+	admin.HandleFunc("/admin/courses/{id}/revisions/{rev:[0-9]+}/restore", s.requirePermission(PermContentWrite, s.restoreCourseRevision)).Methods("POST")
 
 	// Categories Admin
-	admin.HandleFunc("/categories", s.createCategory).Methods("POST")
-	admin.HandleFunc("/categories/reorder", s.reorderCategories).Methods("PUT")
-	admin.HandleFunc("/categories/{id}", s.updateCategory).Methods("PUT")
-	admin.HandleFunc("/categories/{id}", s.deleteCategory).Methods("DELETE")
+	admin.HandleFunc("/categories", s.requirePermission(PermContentWrite, s.createCategory)).Methods("POST")
+	admin.HandleFunc("/categories/reorder", s.requirePermission(PermContentWrite, s.reorderCategories)).Methods("PUT")
+	admin.HandleFunc("/categories/{id}", s.requirePermission(PermContentWrite, s.updateCategory)).Methods("PUT")
+	admin.HandleFunc("/categories/{id}", s.requirePermission(PermCategoriesDelete, s.deleteCategory)).Methods("DELETE")
 
 	// Projects Admin
-	admin.HandleFunc("/projects", s.createProject).Methods("POST")
-	admin.HandleFunc("/projects/reorder", s.reorderProjects).Methods("PUT")
-	admin.HandleFunc("/projects/{id}", s.updateProject).Methods("PUT")
-	admin.HandleFunc("/projects/{id}", s.deleteProject).Methods("DELETE")
+	admin.HandleFunc("/projects", s.requirePermission(PermContentWrite, s.createProject)).Methods("POST")
+	admin.HandleFunc("/projects/reorder", s.requirePermission(PermContentWrite, s.reorderProjects)).Methods("PUT")
+	admin.HandleFunc("/projects/{id}", s.requirePermission(PermContentWrite, s.updateProject)).Methods("PUT")
+	admin.HandleFunc("/projects/{id}", s.requirePermission(PermContentWrite, s.deleteProject)).Methods("DELETE")
 
 	// Certificates Admin
-	admin.HandleFunc("/certificates", s.createCertificate).Methods("POST")
-	admin.HandleFunc("/certificates/reorder", s.reorderCertificates).Methods("PUT")
-	admin.HandleFunc("/certificates/{id}", s.updateCertificate).Methods("PUT")
-	admin.HandleFunc("/certificates/{id}", s.deleteCertificate).Methods("DELETE")
+	admin.HandleFunc("/certificates", s.requirePermission(PermContentWrite, s.createCertificate)).Methods("POST")
+	admin.HandleFunc("/certificates/reorder", s.requirePermission(PermContentWrite, s.reorderCertificates)).Methods("PUT")
+	admin.HandleFunc("/certificates/{id}", s.requirePermission(PermContentWrite, s.updateCertificate)).Methods("PUT")
+	admin.HandleFunc("/certificates/{id}", s.requirePermission(PermContentWrite, s.deleteCertificate)).Methods("DELETE")
+
+	// Admin users (owners only)
+	admin.HandleFunc("/admin/users", s.requirePermission(PermUsersManage, s.getAdminUsers)).Methods("GET")
+	admin.HandleFunc("/admin/users", s.requirePermission(PermUsersManage, s.inviteAdminUser)).Methods("POST")
+	admin.HandleFunc("/admin/users/{id}", s.requirePermission(PermUsersManage, s.updateAdminUser)).Methods("PUT")
+	admin.HandleFunc("/admin/users/{id}", s.requirePermission(PermUsersManage, s.revokeAdminUser)).Methods("DELETE")
+
+	// Trash
+	admin.HandleFunc("/admin/trash", s.requirePermission(PermContentRead, s.getTrash)).Methods("GET")
+	admin.HandleFunc("/admin/trash/{type}/{id}/restore", s.requirePermission(PermArticlesWrite, s.restoreFromTrash)).Methods("POST")
+
+	// Translations; write permission per type is checked in the handlers
+	admin.HandleFunc("/admin/translations/missing", s.requirePermission(PermContentRead, s.getMissingTranslations)).Methods("GET")
+	admin.HandleFunc("/admin/translations/{type}/{id}", s.requirePermission(PermContentRead, s.getTranslations)).Methods("GET")
+	admin.HandleFunc("/admin/translations/{type}/{id}/{locale}", s.requirePermission(PermArticlesWrite, s.putTranslation)).Methods("PUT")
+	admin.HandleFunc("/admin/translations/{type}/{id}/{locale}", s.requirePermission(PermArticlesWrite, s.deleteTranslation)).Methods("DELETE")
+
+	// Contact inbox
+	admin.HandleFunc("/admin/messages", s.requirePermission(PermMessagesManage, s.getMessages)).Methods("GET")
+	admin.HandleFunc("/admin/messages/{id}", s.requirePermission(PermMessagesManage, s.getMessage)).Methods("GET")
+	admin.HandleFunc("/admin/messages/{id}", s.requirePermission(PermMessagesManage, s.updateMessage)).Methods("PUT")
+
+	// Outgoing email
+	admin.HandleFunc("/admin/outbox", s.requirePermission(PermMessagesManage, s.getOutbox)).Methods("GET")
+	admin.HandleFunc("/admin/outbox/{id}/resend", s.requirePermission(PermMessagesManage, s.resendEmail)).Methods("POST")
+
+	// Audit log
+	admin.HandleFunc("/admin/audit", s.requirePermission(PermAuditRead, s.getAuditLog)).Methods("GET")
+
+	// Media Library Admin
+	admin.HandleFunc("/media", s.requirePermission(PermMediaUpload, s.uploadMedia)).Methods("POST")
+	admin.HandleFunc("/media", s.requirePermission(PermContentRead, s.getMedia)).Methods("GET")
+	admin.HandleFunc("/media/{id}", s.requirePermission(PermMediaDelete, s.deleteMedia)).Methods("DELETE")
 
 	// CORS
 	originsStr := os.Getenv("CORS_ORIGINS")
@@ -129,7 +240,8 @@ func main() {
 	corsHandler := handlers.CORS(
 		handlers.AllowedOrigins(originsList),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", requestIDHeader}),
+		handlers.ExposedHeaders([]string{requestIDHeader, totalCountHeader, nextCursorHeader, "Link"}),
 		handlers.AllowCredentials(),
 	)
 
@@ -138,8 +250,27 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s...", port)
-	log.Fatal(http.ListenAndServe(":"+port, corsHandler(r)))
+	srv := &http.Server{Addr: ":" + port, Handler: requestIDMiddleware(corsHandler(r))}
+	go func() {
+		log.Printf("Server starting on port %s...", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// On SIGINT/SIGTERM finish the requests in flight, then send the email they queued
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	<-sigCtx.Done()
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	stopOutbox()
+	<-outbox.Done()
 }
 
 // verifyToken handler (needed by api.ts)
@@ -147,14 +278,13 @@ func (s *Server) verifyToken(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		IDToken string `json:"idToken"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &body) {
 		return
 	}
 
 	token, err := s.authClient.VerifyIDToken(r.Context(), body.IDToken)
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
 
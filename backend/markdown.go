@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	wordsPerMinute      = 200
+	renderCacheCapacity = 500
+)
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+
+	// Article content is written by admins but still rendered as untrusted input
+	htmlPolicy = newHTMLPolicy()
+)
+
+func newHTMLPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[a-z0-9-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	return p
+}
+
+type TOCEntry struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+type RenderedContent struct {
+	HTML        string
+	TOC         []TOCEntry
+	WordCount   int
+	ReadingTime int // minutes
+}
+
+// headingIDs gives headings transliterated, per-document unique anchors
+type headingIDs struct {
+	used map[string]bool
+}
+
+func (h *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	base := transliterate(string(value))
+	if base == "" {
+		base = "section"
+	}
+
+	id := base
+	for n := 2; h.used[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	h.used[id] = true
+	return []byte(id)
+}
+
+func (h *headingIDs) Put(value []byte) {
+	h.used[string(value)] = true
+}
+
+// nodeText concatenates the text of n's descendants
+func nodeText(n ast.Node, src []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			b.Write(t.Segment.Value(src))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(t.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// renderMarkdownDocument converts Markdown to sanitized HTML and collects its outline and length
+func renderMarkdownDocument(source string) (RenderedContent, error) {
+	src := []byte(source)
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{used: map[string]bool{}}))
+	doc := markdown.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+
+	var rc RenderedContent
+	rc.TOC = []TOCEntry{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Heading:
+			entry := TOCEntry{Level: node.Level, Text: strings.TrimSpace(nodeText(node, src))}
+			if id, ok := node.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					entry.ID = string(b)
+				}
+			}
+			rc.TOC = append(rc.TOC, entry)
+		case *ast.Text:
+			rc.WordCount += len(strings.Fields(string(node.Segment.Value(src))))
+		}
+		return ast.WalkContinue, nil
+	})
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, src, doc); err != nil {
+		return rc, err
+	}
+	rc.HTML = htmlPolicy.Sanitize(buf.String())
+
+	if rc.WordCount > 0 {
+		rc.ReadingTime = int(math.Ceil(float64(rc.WordCount) / wordsPerMinute))
+	}
+	return rc, nil
+}
+
+type renderCacheEntry struct {
+	updatedAt time.Time
+	sum       [sha256.Size]byte // of the source, which changes with translations too
+	content   RenderedContent
+}
+
+var renderCache = struct {
+	sync.RWMutex
+	entries map[string]renderCacheEntry
+}{entries: map[string]renderCacheEntry{}}
+
+// renderArticleContent renders an article's Markdown in a locale, reusing the previous
+// result until the article's updated_at or the source (e.g. an edited translation) changes
+func renderArticleContent(id, locale string, updatedAt time.Time, src string) (RenderedContent, error) {
+	key := id + ":" + locale
+	sum := sha256.Sum256([]byte(src))
+	renderCache.RLock()
+	entry, ok := renderCache.entries[key]
+	renderCache.RUnlock()
+	if ok && entry.updatedAt.Equal(updatedAt) && entry.sum == sum {
+		return entry.content, nil
+	}
+
+	rc, err := renderMarkdownDocument(src)
+	if err != nil {
+		return rc, err
+	}
+
+	renderCache.Lock()
+	if len(renderCache.entries) >= renderCacheCapacity {
+		// Evict an arbitrary entry to stay bounded
+		for k := range renderCache.entries {
+			delete(renderCache.entries, k)
+			break
+		}
+	}
+	renderCache.entries[key] = renderCacheEntry{updatedAt: updatedAt, sum: sum, content: rc}
+	renderCache.Unlock()
+
+	return rc, nil
+}
+
+// applyRenderedContent fills the rendered fields of an article translated into locale
+func applyRenderedContent(a *Article, locale string) error {
+	rc, err := renderArticleContent(a.ID, locale, a.UpdatedAt, a.Content)
+	if err != nil {
+		return err
+	}
+	a.ContentHTML = rc.HTML
+	a.TOC = rc.TOC
+	a.WordCount = rc.WordCount
+	a.ReadingTime = rc.ReadingTime
+	return nil
+}
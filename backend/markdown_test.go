@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderMarkdownTOC(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []TOCEntry
+	}{
+		{"no headings", "Just text.", []TOCEntry{}},
+		{"levels", "# Intro\n\n## Details\n\n### Deep *dive*\n", []TOCEntry{
+			{Level: 1, Text: "Intro", ID: "intro"},
+			{Level: 2, Text: "Details", ID: "details"},
+			{Level: 3, Text: "Deep dive", ID: "deep-dive"},
+		}},
+		{"cyrillic anchors", "## Що таке йога?\n", []TOCEntry{
+			{Level: 2, Text: "Що таке йога?", ID: "shcho-take-yoha"},
+		}},
+		{"duplicate headings", "## Steps\n\n## Steps\n\n## Steps\n", []TOCEntry{
+			{Level: 2, Text: "Steps", ID: "steps"},
+			{Level: 2, Text: "Steps", ID: "steps-2"},
+			{Level: 2, Text: "Steps", ID: "steps-3"},
+		}},
+		{"heading without letters", "## !!!\n", []TOCEntry{
+			{Level: 2, Text: "!!!", ID: "section"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := renderMarkdownDocument(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rc.TOC, tt.want) {
+				t.Errorf("TOC = %+v, want %+v", rc.TOC, tt.want)
+			}
+			for _, e := range tt.want {
+				if !strings.Contains(rc.HTML, `id="`+e.ID+`"`) {
+					t.Errorf("HTML has no anchor %q: %s", e.ID, rc.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownReadingTime(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         string
+		wantWords   int
+		wantMinutes int
+	}{
+		{"empty", "", 0, 0},
+		{"one word", "Hello", 1, 1},
+		{"exactly one minute", strings.Repeat("word ", wordsPerMinute), wordsPerMinute, 1},
+		{"just over a minute", strings.Repeat("word ", wordsPerMinute+1), wordsPerMinute + 1, 2},
+		{"markup is not counted", "# Title\n\n**bold** and [a link](https://example.com)", 5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := renderMarkdownDocument(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rc.WordCount != tt.wantWords || rc.ReadingTime != tt.wantMinutes {
+				t.Errorf("words, minutes = %d, %d; want %d, %d", rc.WordCount, rc.ReadingTime, tt.wantWords, tt.wantMinutes)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		banned string
+	}{
+		{"script tag", "<script>alert(1)</script>", "<script"},
+		{"event handler", `<img src="x.png" onerror="alert(1)">`, "onerror"},
+		{"javascript link", "[click](javascript:alert(1))", "javascript:"},
+		{"heading id injection", `<h2 id="x&quot; onclick=&quot;alert(1)">Hi</h2>`, "onclick"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := renderMarkdownDocument(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(rc.HTML, tt.banned) {
+				t.Errorf("HTML contains %q: %s", tt.banned, rc.HTML)
+			}
+		})
+	}
+}
+
+func TestRenderArticleContentCache(t *testing.T) {
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	id := "cache-test"
+
+	en, _ := renderArticleContent(id, "en", updated, "# Hello")
+	uk, _ := renderArticleContent(id, "uk", updated, "# Привіт")
+	if en.TOC[0].Text != "Hello" || uk.TOC[0].Text != "Привіт" {
+		t.Errorf("locales share a cache entry: en %+v, uk %+v", en.TOC, uk.TOC)
+	}
+
+	// A translation edited without touching the article's updated_at
+	edited, _ := renderArticleContent(id, "uk", updated, "# Вітаю")
+	if edited.TOC[0].Text != "Вітаю" {
+		t.Errorf("stale render after the source changed: %+v", edited.TOC)
+	}
+}
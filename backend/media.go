@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	_ "golang.org/x/image/webp"
+)
+
+const defaultMaxUploadBytes = 10 << 20 // 10 MB
+
+// Uploads are identified by their sniffed content, never by the client's name or header
+var allowedMediaTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type Media struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	UploadedBy  string    `json:"uploadedBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	// Progress of variant generation: pending, processing, ready or failed
+	ProcessingStatus string `json:"processingStatus"`
+	ProcessingError  string `json:"processingError,omitempty"`
+}
+
+const mediaColumns = "id, filename, url, content_type, size_bytes, sha256, COALESCE(width, 0), COALESCE(height, 0), COALESCE(uploaded_by, ''), created_at, processing_status, COALESCE(processing_error, '')"
+
+func scanMedia(row rowScanner) (Media, error) {
+	var m Media
+	err := row.Scan(&m.ID, &m.Filename, &m.URL, &m.ContentType, &m.Size, &m.SHA256, &m.Width, &m.Height, &m.UploadedBy, &m.CreatedAt, &m.ProcessingStatus, &m.ProcessingError)
+	return m, err
+}
+
+func maxUploadBytes() int64 {
+	if v := os.Getenv("MEDIA_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxUploadBytes
+}
+
+// uploadMedia stores the multipart "file" field. Re-uploading identical content
+// returns the existing library entry.
+func (s *Server) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	limit := maxUploadBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20) // room for the multipart envelope
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		} else {
+			writeError(w, http.StatusBadRequest, "A file is required in the \"file\" field")
+		}
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		writeAPIError(w, &APIError{Status: http.StatusBadRequest, Message: "Could not read the uploaded file", Cause: err})
+		return
+	}
+	if int64(len(data)) > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedMediaTypes[contentType]
+	if !ok {
+		writeError(w, http.StatusUnsupportedMediaType, "Unsupported file type "+contentType)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	existing, err := scanMedia(db.QueryRow("SELECT "+mediaColumns+" FROM media WHERE sha256=$1", hash))
+	if err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(existing)
+		return
+	}
+	if err != sql.ErrNoRows {
+		writeInternalError(w, err)
+		return
+	}
+
+	// The hash stays that of the original so re-uploads are still recognised
+	stored := stripImageMetadata(data, contentType)
+
+	m := Media{
+		Filename:         header.Filename,
+		ContentType:      contentType,
+		Size:             int64(len(stored)),
+		SHA256:           hash,
+		ProcessingStatus: "pending",
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(stored)); err == nil {
+		m.Width, m.Height = cfg.Width, cfg.Height
+		// Report the dimensions the image is displayed at
+		if contentType == "image/jpeg" && jpegOrientation(stored) >= 5 {
+			m.Width, m.Height = m.Height, m.Width
+		}
+	}
+	if userID, ok := r.Context().Value("userID").(string); ok {
+		m.UploadedBy = userID
+	}
+
+	key := hash[:2] + "/" + hash + ext
+	if err := s.media.Put(r.Context(), key, bytes.NewReader(stored), m.Size, contentType); err != nil {
+		log.Printf("Error storing media %s: %v", key, err)
+		writeError(w, http.StatusInternalServerError, "Failed to store file")
+		return
+	}
+	m.URL = s.media.URL(key)
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"INSERT INTO media (filename, storage_key, url, content_type, size_bytes, sha256, width, height, uploaded_by) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, 0), $9) RETURNING id, created_at",
+		m.Filename, key, m.URL, m.ContentType, m.Size, m.SHA256, m.Width, m.Height, m.UploadedBy,
+	).Scan(&m.ID, &m.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		// An identical upload finished first; return its entry as the dedupe above does
+		tx.Rollback()
+		s.returnConcurrentUpload(w, r, hash, key)
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, "media", "media", m.ID, "create", nil); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	s.processor.Enqueue(m.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m)
+}
+
+// returnConcurrentUpload answers an upload that lost the race to insert the same content.
+// Keys are derived from the content, so the winner usually stored the very same object;
+// ours is only deleted when the winner's entry points elsewhere.
+func (s *Server) returnConcurrentUpload(w http.ResponseWriter, r *http.Request, hash, key string) {
+	existing, err := scanMedia(db.QueryRow("SELECT "+mediaColumns+" FROM media WHERE sha256=$1", hash))
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var existingKey string
+	if err := db.QueryRow("SELECT storage_key FROM media WHERE id=$1", existing.ID).Scan(&existingKey); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if existingKey != key {
+		if err := s.media.Delete(r.Context(), key); err != nil {
+			log.Printf("Error deleting duplicate media %s: %v", key, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(existing)
+}
+
+func (s *Server) getMedia(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, limit := 1, 50
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid page")
+			return
+		}
+		page = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM media").Scan(&total); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	rows, err := db.Query("SELECT "+mediaColumns+" FROM media ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2", limit, (page-1)*limit)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		items = append(items, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (s *Server) deleteMedia(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	// Variant rows go with the media row, so collect their files first
+	var keys []string
+	rows, err := db.Query("SELECT storage_key FROM media_variants WHERE media_id=$1", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			writeInternalError(w, err)
+			return
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "media", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var key string
+	err = tx.QueryRow("DELETE FROM media WHERE id=$1 RETURNING storage_key", id).Scan(&key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Media not found")
+		} else {
+			writeInternalError(w, err)
+		}
+		return
+	}
+	keys = append(keys, key)
+
+	if err := auditRowChange(tx, r, "media", "media", id, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// The row is gone either way; a leftover file is only wasted space
+	for _, key := range keys {
+		if err := s.media.Delete(r.Context(), key); err != nil {
+			log.Printf("Error deleting media file %s: %v", key, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MessageUnread   = "unread"
+	MessageRead     = "read"
+	MessageArchived = "archived"
+	MessageSpam     = "spam"
+)
+
+var messageStatuses = []string{MessageUnread, MessageRead, MessageArchived, MessageSpam}
+
+// ContactMessage is a stored contact form submission
+type ContactMessage struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Subject       string     `json:"subject"`
+	Message       string     `json:"message"`
+	Status        string     `json:"status"`
+	DeliveredAt   *time.Time `json:"deliveredAt"`
+	DeliveryError string     `json:"deliveryError,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+const messageColumns = "id, name, email, subject, message, status, delivered_at, COALESCE(delivery_error, ''), created_at, updated_at"
+
+func scanMessage(row rowScanner) (ContactMessage, error) {
+	var m ContactMessage
+	var deliveredAt sql.NullTime
+	err := row.Scan(&m.ID, &m.Name, &m.Email, &m.Subject, &m.Message, &m.Status, &deliveredAt, &m.DeliveryError, &m.CreatedAt, &m.UpdatedAt)
+	if deliveredAt.Valid {
+		m.DeliveredAt = &deliveredAt.Time
+	}
+	return m, err
+}
+
+// getMessages lists the inbox, newest first. ?status= picks unread, read, archived, spam
+// or all; without it unread and read messages are listed. ?q= searches name, email,
+// subject and message.
+func (s *Server) getMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, limit := 1, defaultPageLimit
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid page")
+			return
+		}
+		page = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	var args sqlArgs
+	conds := []string{"TRUE"}
+	switch status := q.Get("status"); status {
+	case "":
+		conds = append(conds, "status IN ("+args.add(MessageUnread)+", "+args.add(MessageRead)+")")
+	case "all":
+	case MessageUnread, MessageRead, MessageArchived, MessageSpam:
+		conds = append(conds, "status = "+args.add(status))
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid status (expected "+strings.Join(messageStatuses, ", ")+" or all)")
+		return
+	}
+	if v := strings.TrimSpace(q.Get("q")); v != "" {
+		p := args.add("%" + escapeLike(v) + "%")
+		conds = append(conds, "(name ILIKE "+p+" OR email ILIKE "+p+" OR subject ILIKE "+p+" OR message ILIKE "+p+")")
+	}
+	where := strings.Join(conds, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM contact_messages WHERE "+where, args...).Scan(&total); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	query := "SELECT " + messageColumns + " FROM contact_messages WHERE " + where +
+		" ORDER BY created_at DESC, id DESC LIMIT " + args.add(limit) + " OFFSET " + args.add((page-1)*limit)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []ContactMessage{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		items = append(items, m)
+	}
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	counts, err := messageCounts()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":  items,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+		"counts": counts,
+	})
+}
+
+// messageCounts counts the messages in each status, for the inbox badges
+func messageCounts() (map[string]int, error) {
+	counts := map[string]int{}
+	for _, st := range messageStatuses {
+		counts[st] = 0
+	}
+	rows, err := db.Query("SELECT status, COUNT(*) FROM contact_messages GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st string
+		var n int
+		if err := rows.Scan(&st, &n); err != nil {
+			return nil, err
+		}
+		counts[st] = n
+	}
+	return counts, rows.Err()
+}
+
+// escapeLike makes % and _ in a search term match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *Server) getMessage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	m, err := scanMessage(db.QueryRow("SELECT "+messageColumns+" FROM contact_messages WHERE id=$1", id))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// updateMessage moves a message to another status: read, unread, archived or spam
+func (s *Server) updateMessage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	errs := FieldErrors{}
+	errs.oneOf("status", body.Status, messageStatuses...)
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, "contact_messages", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res, err := tx.Exec("UPDATE contact_messages SET status=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2", body.Status, id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	if err := auditRowChange(tx, r, "contact_message", "contact_messages", id, "update", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,16 +4,15 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 )
 
-// AuthMiddleware verifies Firebase ID token from Authorization header and checks for admin rights
+// AuthMiddleware verifies Firebase ID token from Authorization header and resolves the user's admin role
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, "Authorization header is required")
 			return
 		}
 
@@ -27,7 +26,7 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 		ctx := r.Context()
 		decodedToken, err := s.authClient.VerifyIDToken(ctx, token)
 		if err != nil {
-			http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+			writeAPIError(w, &APIError{Status: http.StatusUnauthorized, Message: "Invalid or expired token", Cause: err})
 			return
 		}
 
@@ -39,35 +38,29 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 
 		if userEmail == "" {
 			log.Printf("Security alert: No email claim in token for UID: %s", decodedToken.UID)
-			http.Error(w, "Unauthorized: Email verification required", http.StatusForbidden)
+			writeError(w, http.StatusForbidden, "Unauthorized: Email verification required")
 			return
 		}
 
-		adminEmailsStr := os.Getenv("ADMIN_EMAILS")
-		if adminEmailsStr == "" {
-			log.Println("CRITICAL: ADMIN_EMAILS environment variable is NOT SET. Denying all admin requests.")
-			http.Error(w, "Server configuration error: Admin list missing", http.StatusForbidden)
+		role, err := resolveRole(decodedToken.UID, userEmail, decodedToken.Claims)
+		if err != nil {
+			log.Printf("Error resolving role for %s: %v", userEmail, err)
+			writeError(w, http.StatusInternalServerError, "Failed to check permissions")
 			return
 		}
 
-		isAdmin := false
-		allowedList := strings.Split(adminEmailsStr, ",")
-		for _, email := range allowedList {
-			if strings.ToLower(strings.TrimSpace(email)) == userEmail {
-				isAdmin = true
-				break
-			}
-		}
-
-		if !isAdmin {
+		if role == "" {
 			log.Printf("Access DENIED: User %s tried to perform an admin action", userEmail)
-			http.Error(w, "Access denied: You do not have administrator privileges", http.StatusForbidden)
+			writeError(w, http.StatusForbidden, "Access denied: You do not have administrator privileges")
 			return
 		}
 
 		// Add user ID to context
 		ctx = context.WithValue(ctx, "userID", decodedToken.UID)
 		ctx = context.WithValue(ctx, "token", decodedToken)
+		ctx = context.WithValue(ctx, "email", userEmail)
+		ctx = context.WithValue(ctx, "role", role)
+		ctx = context.WithValue(ctx, "isAdmin", true)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
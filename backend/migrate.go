@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key of the Postgres advisory lock held while migrating,
+// so replicas that start together apply migrations one at a time.
+const migrationLockID = 72451001
+
+// dataMigrations fill in data that SQL alone can't compute. Each runs right after the up
+// script of its version, in the same transaction, so it is applied exactly once.
+var dataMigrations = map[int]func(tx *sql.Tx) error{
+	2: backfillArticleSlugs,
+}
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Missing   bool // applied in the database but not present in this binary
+	Modified  bool // checksum differs from the applied version
+}
+
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// loadMigrations reads migrations/NNNN_name.up.sql and NNNN_name.down.sql pairs, sorted by version
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		fileName := e.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name prefix", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", fileName, versionStr)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration advisory lock
+func withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func withDBConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(conn)
+}
+
+func loadAppliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// migrateUp applies every pending migration, each in its own transaction
+func migrateUp(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := loadAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if a, ok := applied[m.Version]; ok {
+				if a.Checksum != m.Checksum {
+					return fmt.Errorf("migration %04d_%s was modified after being applied (checksum mismatch)", m.Version, m.Name)
+				}
+				continue
+			}
+
+			if err := applyMigration(ctx, conn, m); err != nil {
+				return err
+			}
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if fill := dataMigrations[m.Version]; fill != nil {
+		if err := fill(tx); err != nil {
+			return fmt.Errorf("migration %04d_%s (data): %w", m.Version, m.Name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+		m.Version, m.Name, m.Checksum,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateDown reverts the latest `steps` applied migrations
+func migrateDown(ctx context.Context, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	byVersion := map[int]Migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	return withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := loadAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for i := 0; i < steps && i < len(versions); i++ {
+			m, ok := byVersion[versions[i]]
+			if !ok {
+				return fmt.Errorf("migration %04d_%s is applied but missing from this build", versions[i], applied[versions[i]].Name)
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+			}
+
+			if err := revertMigration(ctx, conn, m); err != nil {
+				return err
+			}
+			log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+func revertMigration(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+		return fmt.Errorf("migration %04d_%s (down): %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version=$1", m.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrationStatus lists known and applied migrations in version order
+func migrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	// No migration lock: status only reads and must not wait while another replica migrates
+	var statuses []MigrationStatus
+	err = withDBConn(ctx, func(conn *sql.Conn) error {
+		applied := map[int]appliedMigration{}
+		var exists bool
+		if err := conn.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			var err error
+			if applied, err = loadAppliedMigrations(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		for _, m := range migrations {
+			st := MigrationStatus{Version: m.Version, Name: m.Name}
+			if a, ok := applied[m.Version]; ok {
+				st.Applied = true
+				st.AppliedAt = a.AppliedAt
+				st.Modified = a.Checksum != m.Checksum
+				delete(applied, m.Version)
+			}
+			statuses = append(statuses, st)
+		}
+
+		// Whatever is left was applied by a newer build
+		for v, a := range applied {
+			statuses = append(statuses, MigrationStatus{Version: v, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, Missing: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// runMigrateCommand implements `server migrate up|down [steps]|status`
+func runMigrateCommand(args []string) error {
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: server migrate up|down [steps]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of steps: %q", args[1])
+			}
+			steps = n
+		}
+		return migrateDown(ctx, steps)
+
+	case "status":
+		statuses, err := migrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, st := range statuses {
+			state, appliedAt := "pending", "-"
+			if st.Applied {
+				state = "applied"
+				appliedAt = st.AppliedAt.Format(time.RFC3339)
+			}
+			if st.Missing {
+				state += " (missing from build)"
+			}
+			if st.Modified {
+				state += " (modified)"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", st.Version, st.Name, state, appliedAt)
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down or status)", args[0])
+	}
+}
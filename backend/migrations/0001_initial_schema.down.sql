@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS certificates;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS courses;
+DROP TABLE IF EXISTS articles;
+DROP TABLE IF EXISTS categories;
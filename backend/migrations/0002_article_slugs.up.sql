@@ -0,0 +1,10 @@
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS slug TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS articles_slug_key ON articles (slug);
+
+-- Previous slugs of renamed articles, so old links can be redirected
+CREATE TABLE IF NOT EXISTS article_slug_history (
+	slug TEXT PRIMARY KEY,
+	article_id UUID NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS article_slug_history_article_id_idx ON article_slug_history (article_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS articles_status_publish_at_idx;
+ALTER TABLE articles DROP COLUMN IF EXISTS publish_at;
+ALTER TABLE articles DROP COLUMN IF EXISTS status;
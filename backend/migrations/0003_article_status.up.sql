@@ -0,0 +1,8 @@
+-- Existing articles were all public, so they start out published
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published'
+	CHECK (status IN ('draft', 'scheduled', 'published', 'archived'));
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE articles SET publish_at = created_at WHERE publish_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS articles_status_publish_at_idx ON articles (status, publish_at);
@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS courses_search_vector_trigger ON courses;
+DROP TRIGGER IF EXISTS articles_search_vector_trigger ON articles;
+DROP FUNCTION IF EXISTS courses_search_vector_update();
+DROP FUNCTION IF EXISTS articles_search_vector_update();
+
+DROP INDEX IF EXISTS courses_search_vector_idx;
+DROP INDEX IF EXISTS articles_search_vector_idx;
+ALTER TABLE courses DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE articles DROP COLUMN IF EXISTS search_vector;
+
+DROP TEXT SEARCH CONFIGURATION IF EXISTS wellness_en;
+DROP TEXT SEARCH CONFIGURATION IF EXISTS wellness_simple;
+DROP EXTENSION IF EXISTS unaccent;
@@ -0,0 +1,57 @@
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- Ukrainian has no built-in stemmer, so it is indexed as unaccented whole words.
+-- English additionally gets the snowball stemmer.
+CREATE TEXT SEARCH CONFIGURATION wellness_simple (COPY = pg_catalog.simple);
+ALTER TEXT SEARCH CONFIGURATION wellness_simple
+	ALTER MAPPING FOR asciiword, asciihword, hword_asciipart, word, hword, hword_part
+	WITH unaccent, simple;
+
+CREATE TEXT SEARCH CONFIGURATION wellness_en (COPY = pg_catalog.english);
+ALTER TEXT SEARCH CONFIGURATION wellness_en
+	ALTER MAPPING FOR asciiword, asciihword, hword_asciipart, word, hword, hword_part
+	WITH unaccent, english_stem;
+
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS search_vector tsvector;
+ALTER TABLE courses ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION articles_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('wellness_en', COALESCE(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('wellness_simple', COALESCE(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('wellness_en', COALESCE(NEW.excerpt, '')), 'B') ||
+		setweight(to_tsvector('wellness_simple', COALESCE(NEW.excerpt, '')), 'B') ||
+		setweight(to_tsvector('wellness_en', COALESCE(NEW.content, '')), 'C') ||
+		setweight(to_tsvector('wellness_simple', COALESCE(NEW.content, '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION courses_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('wellness_en', COALESCE(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('wellness_simple', COALESCE(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('wellness_en', COALESCE(NEW.description, '')), 'B') ||
+		setweight(to_tsvector('wellness_simple', COALESCE(NEW.description, '')), 'B') ||
+		setweight(to_tsvector('wellness_en', COALESCE(array_to_string(NEW.tags, ' '), '')), 'C') ||
+		setweight(to_tsvector('wellness_simple', COALESCE(array_to_string(NEW.tags, ' '), '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER articles_search_vector_trigger
+	BEFORE INSERT OR UPDATE OF title, excerpt, content ON articles
+	FOR EACH ROW EXECUTE FUNCTION articles_search_vector_update();
+
+CREATE TRIGGER courses_search_vector_trigger
+	BEFORE INSERT OR UPDATE OF title, description, tags ON courses
+	FOR EACH ROW EXECUTE FUNCTION courses_search_vector_update();
+
+-- Index existing rows
+UPDATE articles SET title = title;
+UPDATE courses SET title = title;
+
+CREATE INDEX IF NOT EXISTS articles_search_vector_idx ON articles USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS courses_search_vector_idx ON courses USING GIN (search_vector);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS media (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	filename TEXT NOT NULL, -- original name of the uploaded file
+	storage_key TEXT NOT NULL UNIQUE,
+	url TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	sha256 TEXT NOT NULL UNIQUE,
+	width INTEGER,
+	height INTEGER,
+	uploaded_by TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS media_created_at_idx ON media (created_at DESC);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS media_variants;
+DROP INDEX IF EXISTS media_url_idx;
+DROP INDEX IF EXISTS media_processing_status_idx;
+ALTER TABLE media DROP COLUMN IF EXISTS processing_error;
+ALTER TABLE media DROP COLUMN IF EXISTS processing_status;
@@ -0,0 +1,20 @@
+ALTER TABLE media ADD COLUMN IF NOT EXISTS processing_status TEXT NOT NULL DEFAULT 'pending'
+	CHECK (processing_status IN ('pending', 'processing', 'ready', 'failed'));
+ALTER TABLE media ADD COLUMN IF NOT EXISTS processing_error TEXT;
+CREATE INDEX IF NOT EXISTS media_processing_status_idx ON media (processing_status);
+CREATE INDEX IF NOT EXISTS media_url_idx ON media (url);
+
+-- Resized copies of an uploaded image
+CREATE TABLE IF NOT EXISTS media_variants (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	media_id UUID NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+	kind TEXT NOT NULL, -- 'responsive' or 'thumbnail'
+	format TEXT NOT NULL, -- 'jpeg' or 'webp'
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	storage_key TEXT NOT NULL UNIQUE,
+	url TEXT NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (media_id, kind, format, width)
+);
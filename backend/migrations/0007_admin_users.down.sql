@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS articles_created_by_idx;
+ALTER TABLE articles DROP COLUMN IF EXISTS created_by;
+DROP TABLE IF EXISTS admin_users;
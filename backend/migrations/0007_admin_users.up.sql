@@ -0,0 +1,16 @@
+-- People allowed into the admin area, replacing the ADMIN_EMAILS list
+CREATE TABLE IF NOT EXISTS admin_users (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	email TEXT NOT NULL UNIQUE, -- stored lower-cased
+	role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'author', 'viewer')),
+	firebase_uid TEXT UNIQUE, -- linked on first sign-in
+	invited_by TEXT,
+	last_login_at TIMESTAMP WITH TIME ZONE,
+	revoked_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Firebase UID of the article's creator, so authors can be limited to their own articles
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS created_by TEXT;
+CREATE INDEX IF NOT EXISTS articles_created_by_idx ON articles (created_by);
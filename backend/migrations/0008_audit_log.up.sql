@@ -0,0 +1,15 @@
+-- One row per admin mutation
+CREATE TABLE IF NOT EXISTS audit_log (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_uid TEXT,
+	actor_email TEXT,
+	entity_type TEXT NOT NULL, -- 'article', 'course', 'category', ...
+	entity_id TEXT, -- empty for actions on a whole collection, e.g. reorder
+	action TEXT NOT NULL, -- 'create', 'update', 'delete', 'reorder', ...
+	changes JSONB NOT NULL DEFAULT '{}', -- {"field": {"from": ..., "to": ...}}
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at DESC);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor_uid, created_at DESC);
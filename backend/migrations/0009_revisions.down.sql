@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS course_revisions;
+DROP TABLE IF EXISTS article_revisions;
@@ -0,0 +1,52 @@
+-- Every saved version of an article, numbered per article
+CREATE TABLE IF NOT EXISTS article_revisions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	article_id UUID NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+	revision INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	slug TEXT,
+	excerpt TEXT,
+	content TEXT NOT NULL,
+	author TEXT,
+	date DATE,
+	category TEXT,
+	featured BOOLEAN,
+	image TEXT,
+	status TEXT,
+	publish_at TIMESTAMP WITH TIME ZONE,
+	created_by TEXT, -- Firebase UID of the editor
+	created_by_email TEXT,
+	restored_from INTEGER, -- revision this one was restored from
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (article_id, revision)
+);
+
+CREATE TABLE IF NOT EXISTS course_revisions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	revision INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT,
+	lessons TEXT,
+	duration TEXT,
+	price TEXT,
+	category TEXT,
+	tags TEXT[],
+	image TEXT,
+	created_by TEXT,
+	created_by_email TEXT,
+	restored_from INTEGER,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (course_id, revision)
+);
+
+-- The current state of existing content becomes revision 1
+INSERT INTO article_revisions (article_id, revision, title, slug, excerpt, content, author, date, category, featured, image, status, publish_at, created_by, created_at)
+SELECT id, 1, title, slug, excerpt, content, author, date, category, featured, image, status, publish_at, created_by, COALESCE(updated_at, CURRENT_TIMESTAMP)
+FROM articles
+ON CONFLICT (article_id, revision) DO NOTHING;
+
+INSERT INTO course_revisions (course_id, revision, title, description, lessons, duration, price, category, tags, image, created_at)
+SELECT id, 1, title, description, lessons, duration, price, category, tags, image, COALESCE(updated_at, CURRENT_TIMESTAMP)
+FROM courses
+ON CONFLICT (course_id, revision) DO NOTHING;
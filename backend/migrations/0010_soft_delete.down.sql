@@ -0,0 +1,12 @@
+-- Trashed rows would reappear, so they are removed for good
+DELETE FROM articles WHERE deleted_at IS NOT NULL;
+DELETE FROM courses WHERE deleted_at IS NOT NULL;
+DELETE FROM projects WHERE deleted_at IS NOT NULL;
+DELETE FROM certificates WHERE deleted_at IS NOT NULL;
+DELETE FROM categories WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE articles DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE courses DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE projects DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE certificates DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE categories DROP COLUMN IF EXISTS deleted_at;
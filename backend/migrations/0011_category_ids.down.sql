@@ -0,0 +1,5 @@
+ALTER TABLE articles DROP COLUMN IF EXISTS category_id, DROP COLUMN IF EXISTS category_type;
+ALTER TABLE courses DROP COLUMN IF EXISTS category_id, DROP COLUMN IF EXISTS category_type;
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_id_type_key;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_type_check;
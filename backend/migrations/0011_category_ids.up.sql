@@ -0,0 +1,48 @@
+-- Articles and courses reference their category by id. The category column keeps a copy
+-- of the name for filtering and feeds and is rewritten when a category is renamed.
+ALTER TABLE categories ADD CONSTRAINT categories_type_check CHECK (type IN ('blog', 'course')) NOT VALID;
+ALTER TABLE categories ADD CONSTRAINT categories_id_type_key UNIQUE (id, type);
+
+-- Names in use that never had a category row become categories, so no content loses its category
+INSERT INTO categories (name, type, sort_order)
+SELECT names.category, names.type, (SELECT COALESCE(MAX(sort_order), 0) FROM categories) + ROW_NUMBER() OVER (ORDER BY names.type, names.category)
+FROM (
+	SELECT DISTINCT category, 'blog' AS type FROM articles WHERE COALESCE(category, '') <> ''
+	UNION
+	SELECT DISTINCT category, 'course' FROM courses WHERE COALESCE(category, '') <> ''
+) names
+WHERE NOT EXISTS (SELECT 1 FROM categories c WHERE (c.name = names.category OR c.id::text = names.category) AND c.type = names.type)
+	-- The admin stored course categories by id; ids of categories that no longer exist are dropped
+	AND names.category !~ '^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$';
+
+-- category_type is fixed per table; the composite foreign key makes the database reject
+-- a course category on an article and the other way round
+ALTER TABLE articles
+	ADD COLUMN IF NOT EXISTS category_id UUID,
+	ADD COLUMN IF NOT EXISTS category_type TEXT NOT NULL DEFAULT 'blog' CHECK (category_type = 'blog');
+ALTER TABLE articles ADD CONSTRAINT articles_category_fk
+	FOREIGN KEY (category_id, category_type) REFERENCES categories (id, type);
+
+ALTER TABLE courses
+	ADD COLUMN IF NOT EXISTS category_id UUID,
+	ADD COLUMN IF NOT EXISTS category_type TEXT NOT NULL DEFAULT 'course' CHECK (category_type = 'course');
+ALTER TABLE courses ADD CONSTRAINT courses_category_fk
+	FOREIGN KEY (category_id, category_type) REFERENCES categories (id, type);
+
+-- Duplicate names resolve to the live, first listed category
+UPDATE articles a SET category_id = (
+	SELECT c.id FROM categories c WHERE c.type = 'blog' AND c.name = a.category
+	ORDER BY c.deleted_at IS NOT NULL, c.sort_order, c.created_at LIMIT 1
+) WHERE COALESCE(a.category, '') <> '';
+
+UPDATE courses co SET category_id = (
+	SELECT c.id FROM categories c WHERE c.type = 'course' AND (c.id::text = co.category OR c.name = co.category)
+	ORDER BY c.id::text = co.category DESC, c.deleted_at IS NOT NULL, c.sort_order, c.created_at LIMIT 1
+) WHERE COALESCE(co.category, '') <> '';
+
+-- The name copy always holds the current name, never an id
+UPDATE articles a SET category = COALESCE((SELECT c.name FROM categories c WHERE c.id = a.category_id), '');
+UPDATE courses co SET category = COALESCE((SELECT c.name FROM categories c WHERE c.id = co.category_id), '');
+
+CREATE INDEX IF NOT EXISTS articles_category_id_idx ON articles (category_id);
+CREATE INDEX IF NOT EXISTS courses_category_id_idx ON courses (category_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS category_translations;
+DROP TABLE IF EXISTS certificate_translations;
+DROP TABLE IF EXISTS project_translations;
+DROP TABLE IF EXISTS course_translations;
+DROP TABLE IF EXISTS article_translations;
@@ -0,0 +1,61 @@
+-- Content rows hold the text in the default locale; these tables hold the other locales.
+-- A NULL or empty field falls back to the default locale.
+CREATE TABLE IF NOT EXISTS article_translations (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	article_id UUID NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+	locale TEXT NOT NULL CHECK (locale ~ '^[a-z]{2}$'),
+	title TEXT,
+	excerpt TEXT,
+	content TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (article_id, locale)
+);
+
+CREATE TABLE IF NOT EXISTS course_translations (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	locale TEXT NOT NULL CHECK (locale ~ '^[a-z]{2}$'),
+	title TEXT,
+	description TEXT,
+	lessons TEXT,
+	duration TEXT,
+	tags TEXT[],
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (course_id, locale)
+);
+
+CREATE TABLE IF NOT EXISTS project_translations (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	locale TEXT NOT NULL CHECK (locale ~ '^[a-z]{2}$'),
+	title TEXT,
+	description TEXT,
+	detail TEXT,
+	link_label TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (project_id, locale)
+);
+
+CREATE TABLE IF NOT EXISTS certificate_translations (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	certificate_id UUID NOT NULL REFERENCES certificates(id) ON DELETE CASCADE,
+	locale TEXT NOT NULL CHECK (locale ~ '^[a-z]{2}$'),
+	title TEXT,
+	issuer TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (certificate_id, locale)
+);
+
+CREATE TABLE IF NOT EXISTS category_translations (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	locale TEXT NOT NULL CHECK (locale ~ '^[a-z]{2}$'),
+	name TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (category_id, locale)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS course_enrollments;
+ALTER TABLE courses DROP COLUMN IF EXISTS capacity;
+ALTER TABLE courses DROP COLUMN IF EXISTS enrollment_open;
@@ -0,0 +1,20 @@
+-- Native enrollment. Courses keep their off-site enroll link until enrollment is opened.
+ALTER TABLE courses ADD COLUMN IF NOT EXISTS enrollment_open BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE courses ADD COLUMN IF NOT EXISTS capacity INTEGER CHECK (capacity IS NULL OR capacity > 0);
+
+CREATE TABLE IF NOT EXISTS course_enrollments (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	phone TEXT NOT NULL DEFAULT '',
+	locale TEXT NOT NULL DEFAULT 'en',
+	status TEXT NOT NULL CHECK (status IN ('enrolled', 'waitlisted', 'cancelled')),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One active enrollment per email and course; a cancelled one may enroll again
+CREATE UNIQUE INDEX IF NOT EXISTS course_enrollments_email_idx
+	ON course_enrollments (course_id, lower(email)) WHERE status <> 'cancelled';
+CREATE INDEX IF NOT EXISTS course_enrollments_course_idx ON course_enrollments (course_id, status, created_at);
@@ -0,0 +1,18 @@
+ALTER TABLE course_revisions
+	DROP COLUMN IF EXISTS price_free,
+	DROP COLUMN IF EXISTS price_amount,
+	DROP COLUMN IF EXISTS price_currency,
+	DROP COLUMN IF EXISTS discount_amount,
+	DROP COLUMN IF EXISTS discount_starts_at,
+	DROP COLUMN IF EXISTS discount_ends_at;
+
+ALTER TABLE courses
+	DROP COLUMN IF EXISTS price_free,
+	DROP COLUMN IF EXISTS price_amount,
+	DROP COLUMN IF EXISTS price_currency,
+	DROP COLUMN IF EXISTS discount_amount,
+	DROP COLUMN IF EXISTS discount_starts_at,
+	DROP COLUMN IF EXISTS discount_ends_at;
+
+ALTER TABLE course_revisions RENAME COLUMN enroll_link TO price;
+ALTER TABLE courses RENAME COLUMN enroll_link TO price;
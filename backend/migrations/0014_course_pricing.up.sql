@@ -0,0 +1,25 @@
+-- The price column has always held the enrollment URL; name it after what it holds
+ALTER TABLE courses RENAME COLUMN price TO enroll_link;
+ALTER TABLE course_revisions RENAME COLUMN price TO enroll_link;
+
+-- Prices are stored in minor units of their currency (cents, kopiykas). A course without
+-- an amount and not marked free shows no price. The discount is taken off the amount
+-- between its optional start and end.
+ALTER TABLE courses
+	ADD COLUMN price_free BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN price_amount BIGINT CHECK (price_amount >= 0),
+	ADD COLUMN price_currency TEXT CHECK (price_currency ~ '^[A-Z]{3}$'),
+	ADD COLUMN discount_amount BIGINT CHECK (discount_amount > 0),
+	ADD COLUMN discount_starts_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN discount_ends_at TIMESTAMP WITH TIME ZONE,
+	ADD CONSTRAINT courses_price_currency_check CHECK (price_amount IS NULL OR price_currency IS NOT NULL),
+	ADD CONSTRAINT courses_discount_check CHECK (discount_amount IS NULL OR discount_amount < price_amount),
+	ADD CONSTRAINT courses_discount_window_check CHECK (discount_starts_at IS NULL OR discount_ends_at IS NULL OR discount_starts_at < discount_ends_at);
+
+ALTER TABLE course_revisions
+	ADD COLUMN price_free BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN price_amount BIGINT,
+	ADD COLUMN price_currency TEXT,
+	ADD COLUMN discount_amount BIGINT,
+	ADD COLUMN discount_starts_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN discount_ends_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,26 @@
+-- Courses are split into ordered modules of ordered lessons. The lesson count and total
+-- duration of a course are computed from them; the free-text lessons and duration
+-- columns remain for courses without a structure.
+CREATE TABLE IF NOT EXISTS course_modules (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS course_modules_course_idx ON course_modules (course_id, sort_order);
+
+CREATE TABLE IF NOT EXISTS course_lessons (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	module_id UUID NOT NULL REFERENCES course_modules(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	duration_minutes INTEGER NOT NULL DEFAULT 0 CHECK (duration_minutes >= 0),
+	preview BOOLEAN NOT NULL DEFAULT false,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS course_lessons_module_idx ON course_lessons (module_id, sort_order);
@@ -0,0 +1,16 @@
+-- Contact form submissions are stored before they are emailed, so none are lost when
+-- SMTP is down. delivered_at stays NULL until the notification email went out.
+CREATE TABLE IF NOT EXISTS contact_messages (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	subject TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'unread' CHECK (status IN ('unread', 'read', 'archived', 'spam')),
+	delivered_at TIMESTAMP WITH TIME ZONE,
+	delivery_error TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS contact_messages_status_idx ON contact_messages (status, created_at DESC);
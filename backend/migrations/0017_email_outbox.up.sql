@@ -0,0 +1,21 @@
+-- Outgoing email is queued here and sent by a background worker with retries. A message
+-- that keeps failing ends up 'dead' until an admin re-sends it.
+CREATE TABLE IF NOT EXISTS email_outbox (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	recipient TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL,
+	reply_to TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'dead')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_error TEXT,
+	sent_at TIMESTAMP WITH TIME ZONE,
+	-- Set for contact form notifications, whose delivery is shown in the inbox
+	contact_message_id UUID REFERENCES contact_messages(id) ON DELETE SET NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_due_idx ON email_outbox (next_attempt_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX IF NOT EXISTS email_outbox_status_idx ON email_outbox (status, created_at DESC);
@@ -0,0 +1,2 @@
+-- Emails are sent as multipart/alternative; body stays the plain-text part
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS html_body TEXT NOT NULL DEFAULT '';
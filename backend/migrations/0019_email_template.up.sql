@@ -0,0 +1,3 @@
+-- Name of the template an email was rendered from, so limits can ignore its locale
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS template TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS email_outbox_template_recipient_idx ON email_outbox (template, lower(recipient), created_at);
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	EmailPending = "pending"
+	EmailSending = "sending"
+	EmailSent    = "sent"
+	EmailDead    = "dead"
+)
+
+var emailStatuses = []string{EmailPending, EmailSending, EmailSent, EmailDead}
+
+const (
+	outboxPollInterval   = 15 * time.Second
+	outboxBatchSize      = 10
+	outboxBackoffBase    = 30 * time.Second
+	outboxBackoffMax     = time.Hour
+	outboxSendingTimeout = 10 * time.Minute // a claim older than this was lost in a crash
+	outboxSendTimeout    = time.Minute
+)
+
+// outboxWake nudges the worker to send right away instead of at its next poll
+var outboxWake = make(chan struct{}, 1)
+
+// OutboxEmail is one queued email
+type OutboxEmail struct {
+	ID               string     `json:"id"`
+	To               string     `json:"to"`
+	Subject          string     `json:"subject"`
+	Body             string     `json:"body"`
+	HTMLBody         string     `json:"htmlBody,omitempty"`
+	ReplyTo          string     `json:"replyTo,omitempty"`
+	Template         string     `json:"template,omitempty"`
+	Status           string     `json:"status"`
+	Attempts         int        `json:"attempts"`
+	NextAttemptAt    time.Time  `json:"nextAttemptAt"`
+	LastError        string     `json:"lastError,omitempty"`
+	SentAt           *time.Time `json:"sentAt"`
+	ContactMessageID string     `json:"contactMessageId,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+const outboxColumns = "id, recipient, subject, body, html_body, reply_to, template, status, attempts, next_attempt_at, COALESCE(last_error, ''), sent_at, COALESCE(contact_message_id::text, ''), created_at, updated_at"
+
+func scanOutboxEmail(row rowScanner) (OutboxEmail, error) {
+	var e OutboxEmail
+	var sentAt sql.NullTime
+	err := row.Scan(&e.ID, &e.To, &e.Subject, &e.Body, &e.HTMLBody, &e.ReplyTo, &e.Template, &e.Status, &e.Attempts, &e.NextAttemptAt, &e.LastError, &sentAt, &e.ContactMessageID, &e.CreatedAt, &e.UpdatedAt)
+	if sentAt.Valid {
+		e.SentAt = &sentAt.Time
+	}
+	return e, err
+}
+
+// execer is a *sql.DB or a *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// queueEmail adds an email to the outbox. Queue it in the transaction of the change it
+// belongs to and call wakeOutbox after the commit.
+func queueEmail(ex execer, e OutboxEmail) error {
+	_, err := ex.Exec(
+		"INSERT INTO email_outbox (recipient, subject, body, html_body, reply_to, template, contact_message_id) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::uuid)",
+		e.To, e.Subject, e.Body, e.HTMLBody, e.ReplyTo, e.Template, e.ContactMessageID,
+	)
+	return err
+}
+
+func wakeOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// outboxBackoff is the wait before the next attempt after the given number of failed
+// attempts: 30s, 1m, 2m... up to an hour
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxBackoffBase
+	for i := 1; i < attempts && d < outboxBackoffMax; i++ {
+		d *= 2
+	}
+	if d > outboxBackoffMax {
+		d = outboxBackoffMax
+	}
+	return d
+}
+
+// outboxWorker sends queued email in the background so requests never wait on SMTP
+type outboxWorker struct {
+	mailer       Mailer
+	maxAttempts  int
+	drainTimeout time.Duration
+	done         chan struct{}
+}
+
+// newOutboxWorker reads OUTBOX_MAX_ATTEMPTS (default 8) and OUTBOX_DRAIN_SECONDS (default 10)
+func newOutboxWorker(mailer Mailer) *outboxWorker {
+	w := &outboxWorker{mailer: mailer, maxAttempts: 8, drainTimeout: 10 * time.Second, done: make(chan struct{})}
+	if v := os.Getenv("OUTBOX_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			w.maxAttempts = n
+		}
+	}
+	if v := os.Getenv("OUTBOX_DRAIN_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			w.drainTimeout = time.Duration(n) * time.Second
+		}
+	}
+	return w
+}
+
+// Run sends due email until ctx is done, then drains what is due for up to drainTimeout
+// and closes Done
+func (o *outboxWorker) Run(ctx context.Context) {
+	defer close(o.done)
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for o.sendBatch(time.Time{}) > 0 {
+		}
+
+		select {
+		case <-ctx.Done():
+			o.drain()
+			return
+		case <-ticker.C:
+		case <-outboxWake:
+		}
+	}
+}
+
+// Done is closed once the worker has drained and stopped
+func (o *outboxWorker) Done() <-chan struct{} {
+	return o.done
+}
+
+// drain sends due email until none is left or drainTimeout is up. Each send is cut off at
+// the deadline and unsent email stays queued for the next start.
+func (o *outboxWorker) drain() {
+	deadline := time.Now().Add(o.drainTimeout)
+	for time.Now().Before(deadline) {
+		if o.sendBatch(deadline) == 0 {
+			return
+		}
+	}
+	log.Printf("Outbox drain timed out; remaining email is sent after the restart")
+}
+
+// sendBatch claims and sends up to outboxBatchSize due emails and returns how many it
+// claimed. With a non-zero deadline, emails not started by then are put back in the queue.
+func (o *outboxWorker) sendBatch(deadline time.Time) int {
+	// SKIP LOCKED lets several server instances share the outbox
+	rows, err := db.Query(`
+		UPDATE email_outbox SET status=$1, attempts=attempts+1, updated_at=CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE (status=$2 AND next_attempt_at <= CURRENT_TIMESTAMP) OR (status=$1 AND updated_at < $3)
+			ORDER BY next_attempt_at LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns,
+		EmailSending, EmailPending, time.Now().Add(-outboxSendingTimeout), outboxBatchSize,
+	)
+	if err != nil {
+		log.Printf("Error claiming outbox email: %v", err)
+		return 0
+	}
+	var batch []OutboxEmail
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			log.Printf("Error claiming outbox email: %v", err)
+			break
+		}
+		batch = append(batch, e)
+	}
+	rows.Close()
+
+	for i, e := range batch {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			o.release(batch[i:])
+			break
+		}
+		o.send(e, deadline)
+	}
+	return len(batch)
+}
+
+// release puts claimed but unsent emails back in the queue without using up an attempt
+func (o *outboxWorker) release(emails []OutboxEmail) {
+	for _, e := range emails {
+		_, err := db.Exec(
+			"UPDATE email_outbox SET status=$1, attempts=attempts-1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 AND status=$3",
+			EmailPending, e.ID, EmailSending,
+		)
+		if err != nil {
+			log.Printf("Error releasing email %s: %v", e.ID, err)
+		}
+	}
+}
+
+func (o *outboxWorker) send(e OutboxEmail, deadline time.Time) {
+	// Not the Run context, which is already done while draining; the drain deadline
+	// cuts the send off instead
+	sendBy := time.Now().Add(outboxSendTimeout)
+	if !deadline.IsZero() && deadline.Before(sendBy) {
+		sendBy = deadline
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), sendBy)
+	sendErr := o.mailer.Send(ctx, Email{To: e.To, ReplyTo: e.ReplyTo, Subject: e.Subject, Body: e.Body, HTML: e.HTMLBody})
+	cancel()
+	if sendErr == nil {
+		if _, err := db.Exec("UPDATE email_outbox SET status=$1, sent_at=CURRENT_TIMESTAMP, last_error=NULL, updated_at=CURRENT_TIMESTAMP WHERE id=$2", EmailSent, e.ID); err != nil {
+			log.Printf("Error recording sent email %s: %v", e.ID, err)
+		}
+		if e.ContactMessageID != "" {
+			if _, err := db.Exec("UPDATE contact_messages SET delivered_at=CURRENT_TIMESTAMP, delivery_error=NULL WHERE id=$1", e.ContactMessageID); err != nil {
+				log.Printf("Error recording delivery of contact message %s: %v", e.ContactMessageID, err)
+			}
+		}
+		return
+	}
+
+	status, next := EmailPending, time.Now().Add(outboxBackoff(e.Attempts))
+	if permanentSendError(sendErr) {
+		status = EmailDead
+		log.Printf("Email %s to %s can't be delivered, giving up: %v", e.ID, e.To, sendErr)
+	} else if e.Attempts >= o.maxAttempts {
+		status = EmailDead
+		log.Printf("Email %s to %s failed %d times, giving up: %v", e.ID, e.To, e.Attempts, sendErr)
+	} else {
+		log.Printf("Email %s to %s failed (attempt %d), retrying at %s: %v", e.ID, e.To, e.Attempts, next.Format(time.RFC3339), sendErr)
+	}
+	_, err := db.Exec(
+		"UPDATE email_outbox SET status=$1, next_attempt_at=$2, last_error=$3, updated_at=CURRENT_TIMESTAMP WHERE id=$4",
+		status, next, sendErr.Error(), e.ID,
+	)
+	if err != nil {
+		log.Printf("Error recording failed email %s: %v", e.ID, err)
+	}
+	if e.ContactMessageID != "" {
+		if _, err := db.Exec("UPDATE contact_messages SET delivery_error=$1 WHERE id=$2", sendErr.Error(), e.ContactMessageID); err != nil {
+			log.Printf("Error recording delivery failure of contact message %s: %v", e.ContactMessageID, err)
+		}
+	}
+}
+
+// getOutbox lists queued and sent email, newest first, optionally of one ?status=
+func (s *Server) getOutbox(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, limit := 1, defaultPageLimit
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid page")
+			return
+		}
+		page = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	var args sqlArgs
+	where := "TRUE"
+	switch status := q.Get("status"); status {
+	case "":
+	case EmailPending, EmailSending, EmailSent, EmailDead:
+		where = "status = " + args.add(status)
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid status (expected "+strings.Join(emailStatuses, ", ")+")")
+		return
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM email_outbox WHERE "+where, args...).Scan(&total); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	rows, err := db.Query("SELECT "+outboxColumns+" FROM email_outbox WHERE "+where+
+		" ORDER BY created_at DESC, id DESC LIMIT "+args.add(limit)+" OFFSET "+args.add((page-1)*limit), args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []OutboxEmail{}
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// resendEmail puts a dead or sent email back in the queue with a fresh set of attempts
+func (s *Server) resendEmail(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM email_outbox WHERE id=$1 FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Email not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if status == EmailSending {
+		writeError(w, http.StatusConflict, "Email is being sent")
+		return
+	}
+
+	_, err = tx.Exec("UPDATE email_outbox SET status=$1, attempts=0, next_attempt_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP WHERE id=$2", EmailPending, id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	err = insertAudit(tx, r, "email", id, "resend", map[string]FieldChange{
+		"status": {From: status, To: EmailPending},
+	})
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	wakeOutbox()
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// GET /api/articles returns a JSON array as it always has; the paging metadata
+// travels in these headers
+const (
+	totalCountHeader = "X-Total-Count"
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// articleSort describes one ?sort= option: the column to order by and its direction
+type articleSort struct {
+	column string
+	desc   bool
+	cast   string // SQL type of the cursor value
+}
+
+var articleSorts = map[string]articleSort{
+	// Articles without a date sort by the day they were created, here and in the cursor
+	"date":    {column: "COALESCE(date, created_at::date)", desc: true, cast: "date"},
+	"title":   {column: "title", desc: false, cast: "text"},
+	"updated": {column: "updated_at", desc: true, cast: "timestamptz"},
+}
+
+type articleCursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+type ArticleListParams struct {
+	Page           int
+	Limit          int
+	After          *articleCursor
+	Sort           string
+	Category       string
+	CategoryID     string
+	Author         string
+	Featured       *bool
+	Status         string
+	IncludeContent bool
+}
+
+func parseArticleListParams(r *http.Request) (ArticleListParams, error) {
+	q := r.URL.Query()
+	p := ArticleListParams{
+		Page:           1,
+		Limit:          defaultPageLimit,
+		Sort:           "date",
+		Category:       q.Get("category"),
+		CategoryID:     q.Get("categoryId"),
+		Author:         q.Get("author"),
+		Status:         q.Get("status"),
+		IncludeContent: q.Get("include") == "content",
+	}
+
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid page %q", v)
+		}
+		p.Page = n
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return p, fmt.Errorf("invalid limit %q (1-%d)", v, maxPageLimit)
+		}
+		p.Limit = n
+	}
+
+	if v := q.Get("sort"); v != "" {
+		if _, ok := articleSorts[v]; !ok {
+			return p, fmt.Errorf("invalid sort %q (expected date, title or updated)", v)
+		}
+		p.Sort = v
+	}
+
+	if p.CategoryID != "" && !isUUID(p.CategoryID) {
+		return p, fmt.Errorf("invalid categoryId %q", p.CategoryID)
+	}
+
+	if v := q.Get("featured"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid featured %q", v)
+		}
+		p.Featured = &b
+	}
+
+	if v := q.Get("after"); v != "" {
+		c, err := decodeArticleCursor(v, p.Sort)
+		if err != nil {
+			return p, fmt.Errorf("invalid cursor")
+		}
+		p.After = c
+	}
+
+	return p, nil
+}
+
+func encodeArticleCursor(c articleCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeArticleCursor checks the cursor fully, so a crafted value is a bad request and never
+// reaches the SQL casts
+func decodeArticleCursor(s, sort string) (*articleCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c articleCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if !isUUID(c.ID) {
+		return nil, fmt.Errorf("cursor id is not a UUID")
+	}
+	switch sort {
+	case "date":
+		_, err = time.Parse("2006-01-02", c.Value)
+	case "title":
+		if c.Value == "" {
+			err = fmt.Errorf("cursor without title")
+		}
+	case "updated":
+		_, err = time.Parse(time.RFC3339Nano, c.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// cursorFor returns the cursor pointing just past article a in the given sort order
+func cursorFor(a Article, sort string) string {
+	c := articleCursor{ID: a.ID}
+	switch sort {
+	case "date":
+		c.Value = a.Date
+	case "title":
+		c.Value = a.Title
+	case "updated":
+		c.Value = a.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return encodeArticleCursor(c)
+}
+
+// setPageHeaders reports the total and, when another page follows, its cursor both on its
+// own and as a Link to the next page
+func setPageHeaders(w http.ResponseWriter, r *http.Request, total int, nextCursor string) {
+	w.Header().Set(totalCountHeader, strconv.Itoa(total))
+	if nextCursor == "" {
+		return
+	}
+	w.Header().Set(nextCursorHeader, nextCursor)
+
+	q := r.URL.Query()
+	q.Del("page")
+	q.Set("after", nextCursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	w.Header().Set("Link", "<"+next.String()+`>; rel="next"`)
+}
+
+// sqlArgs collects positional query arguments
+type sqlArgs []interface{}
+
+func (a *sqlArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// articleListQuery builds the filtered page query and the matching count query
+func articleListQuery(r *http.Request, p ArticleListParams) (query string, args sqlArgs, countQuery string, countArgs sqlArgs) {
+	conds := []string{articleVisibility(r)}
+
+	if p.Status != "" && isAdmin(r) {
+		conds = append(conds, "status="+args.add(p.Status))
+	}
+	if p.Category != "" {
+		conds = append(conds, "category="+args.add(p.Category))
+	}
+	if p.CategoryID != "" {
+		conds = append(conds, "category_id="+args.add(p.CategoryID))
+	}
+	if p.Author != "" {
+		conds = append(conds, "author="+args.add(p.Author))
+	}
+	if p.Featured != nil {
+		conds = append(conds, "featured="+args.add(*p.Featured))
+	}
+
+	countQuery = "SELECT COUNT(*) FROM articles WHERE " + strings.Join(conds, " AND ")
+	countArgs = append(sqlArgs{}, args...)
+
+	sort := articleSorts[p.Sort]
+	dir, cmp := "ASC", ">"
+	if sort.desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if p.After != nil {
+		conds = append(conds, fmt.Sprintf("(%s, id) %s (%s::%s, %s::uuid)",
+			sort.column, cmp, args.add(p.After.Value), sort.cast, args.add(p.After.ID)))
+	}
+
+	query = "SELECT " + articleColumns + " FROM articles WHERE " + strings.Join(conds, " AND ") +
+		fmt.Sprintf(" ORDER BY %s %s, id %s", sort.column, dir, dir) +
+		" LIMIT " + args.add(p.Limit+1)
+
+	// Cursor pagination starts right after the cursor, page numbers only apply without one
+	if p.After == nil && p.Page > 1 {
+		query += " OFFSET " + args.add((p.Page-1)*p.Limit)
+	}
+
+	return query, args, countQuery, countArgs
+}
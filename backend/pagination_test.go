@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testArticleID = "3f1c2a4e-8b7d-4c21-9e0f-1a2b3c4d5e6f"
+
+func TestArticleCursorRoundTrip(t *testing.T) {
+	updated := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	a := Article{ID: testArticleID, Title: "Привіт, світ", Date: "2024-05-06", UpdatedAt: updated}
+
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"date", "2024-05-06"},
+		{"title", "Привіт, світ"},
+		{"updated", updated.Format(time.RFC3339Nano)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			c, err := decodeArticleCursor(cursorFor(a, tt.sort), tt.sort)
+			if err != nil {
+				t.Fatalf("decoding our own cursor: %v", err)
+			}
+			if c.ID != a.ID || c.Value != tt.want {
+				t.Errorf("cursor = %+v, want id %s and value %q", *c, a.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeArticleCursorRejects(t *testing.T) {
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+	}{
+		{"not base64", "%%%", "date"},
+		{"not JSON", raw("nope"), "date"},
+		{"missing id", raw(`{"v":"2024-05-06"}`), "date"},
+		{"id not a UUID", raw(`{"v":"2024-05-06","id":"1 OR 1=1"}`), "date"},
+		{"bad date", raw(`{"v":"yesterday","id":"` + testArticleID + `"}`), "date"},
+		{"date with a time", raw(`{"v":"2024-05-06T10:00:00Z","id":"` + testArticleID + `"}`), "date"},
+		{"empty title", raw(`{"v":"","id":"` + testArticleID + `"}`), "title"},
+		{"bad timestamp", raw(`{"v":"2024-05-06","id":"` + testArticleID + `"}`), "updated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if c, err := decodeArticleCursor(tt.cursor, tt.sort); err == nil {
+				t.Errorf("decodeArticleCursor accepted %q as %+v", tt.cursor, *c)
+			}
+		})
+	}
+}
+
+func TestParseArticleListParams(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+		check   func(t *testing.T, p ArticleListParams)
+	}{
+		{query: "", check: func(t *testing.T, p ArticleListParams) {
+			if p.Page != 1 || p.Limit != defaultPageLimit || p.Sort != "date" || p.After != nil {
+				t.Errorf("defaults = %+v", p)
+			}
+		}},
+		{query: "page=3&limit=5&sort=title&featured=true", check: func(t *testing.T, p ArticleListParams) {
+			if p.Page != 3 || p.Limit != 5 || p.Sort != "title" || p.Featured == nil || !*p.Featured {
+				t.Errorf("params = %+v", p)
+			}
+		}},
+		{query: "page=0", wantErr: "invalid page"},
+		{query: "limit=101", wantErr: "invalid limit"},
+		{query: "sort=random", wantErr: "invalid sort"},
+		{query: "categoryId=abc", wantErr: "invalid categoryId"},
+		{query: "featured=maybe", wantErr: "invalid featured"},
+		{query: "after=%25%25", wantErr: "invalid cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			p, err := parseArticleListParams(httptest.NewRequest(http.MethodGet, "/api/articles?"+tt.query, nil))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, p)
+		})
+	}
+}
+
+func TestArticleListQueryCursor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/articles", nil)
+	p := ArticleListParams{Page: 2, Limit: 10, Sort: "date", After: &articleCursor{Value: "2024-05-06", ID: testArticleID}}
+
+	query, args, _, _ := articleListQuery(r, p)
+
+	sortKey := "COALESCE(date, created_at::date)"
+	if !strings.Contains(query, "("+sortKey+", id) < ($1::date, $2::uuid)") {
+		t.Errorf("cursor condition missing or not on %s: %s", sortKey, query)
+	}
+	if !strings.Contains(query, "ORDER BY "+sortKey+" DESC, id DESC") {
+		t.Errorf("not ordered by %s: %s", sortKey, query)
+	}
+	if strings.Contains(query, "OFFSET") {
+		t.Errorf("cursor queries must not use the page offset: %s", query)
+	}
+	if len(args) != 3 || args[2] != 11 {
+		t.Errorf("args = %v, want cursor value, id and limit+1", args)
+	}
+}
+
+func TestSetPageHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/articles?page=2&category=go", nil)
+	w := httptest.NewRecorder()
+	setPageHeaders(w, r, 42, "abc")
+
+	if got := w.Header().Get(totalCountHeader); got != "42" {
+		t.Errorf("%s = %q", totalCountHeader, got)
+	}
+	if got := w.Header().Get(nextCursorHeader); got != "abc" {
+		t.Errorf("%s = %q", nextCursorHeader, got)
+	}
+	if got, want := w.Header().Get("Link"), `</api/articles?after=abc&category=go>; rel="next"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	setPageHeaders(w, r, 3, "")
+	if w.Header().Get(nextCursorHeader) != "" || w.Header().Get("Link") != "" {
+		t.Errorf("last page has next headers: %v", w.Header())
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// CoursePricing is the price of a course. Amounts are in minor units of the currency,
+// so 4900 USD is $49.00 and 1500 JPY is ¥1,500.
+type CoursePricing struct {
+	Free     bool           `json:"free"`
+	Amount   int64          `json:"amount"`
+	Currency string         `json:"currency"` // ISO 4217 code
+	Discount *PriceDiscount `json:"discount,omitempty"`
+
+	// Set when the course is read
+	Current          int64  `json:"current"` // amount to pay now, discount included
+	DiscountActive   bool   `json:"discountActive"`
+	Formatted        string `json:"formatted"`
+	FormattedRegular string `json:"formattedRegular,omitempty"` // amount before the discount, while one is active
+}
+
+// PriceDiscount is taken off the amount between StartsAt and EndsAt; either end may be open
+type PriceDiscount struct {
+	Amount   int64      `json:"amount"`
+	StartsAt *time.Time `json:"startsAt,omitempty"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+}
+
+const pricingColumns = "price_free, price_amount, price_currency, discount_amount, discount_starts_at, discount_ends_at"
+
+// Locales that write the currency symbol after the amount
+var symbolAfterAmount = map[string]bool{"uk": true}
+
+var freeLabels = map[string]string{"en": "Free", "uk": "Безкоштовно"}
+
+// pricingScan holds the pricing columns while a course row is scanned
+type pricingScan struct {
+	free           bool
+	amount         sql.NullInt64
+	currency       sql.NullString
+	discount       sql.NullInt64
+	discountStarts sql.NullTime
+	discountEnds   sql.NullTime
+}
+
+func (p *pricingScan) dest() []interface{} {
+	return []interface{}{&p.free, &p.amount, &p.currency, &p.discount, &p.discountStarts, &p.discountEnds}
+}
+
+// pricing builds the course pricing, nil when the course has no price
+func (p *pricingScan) pricing() *CoursePricing {
+	if p.free {
+		return &CoursePricing{Free: true}
+	}
+	if !p.amount.Valid {
+		return nil
+	}
+	pr := &CoursePricing{Amount: p.amount.Int64, Currency: p.currency.String}
+	if p.discount.Valid {
+		pr.Discount = &PriceDiscount{Amount: p.discount.Int64}
+		if p.discountStarts.Valid {
+			pr.Discount.StartsAt = &p.discountStarts.Time
+		}
+		if p.discountEnds.Valid {
+			pr.Discount.EndsAt = &p.discountEnds.Time
+		}
+	}
+	return pr
+}
+
+// pricingArgs are the values of pricingColumns for an insert or update
+func pricingArgs(p *CoursePricing) []interface{} {
+	if p == nil {
+		return []interface{}{false, nil, nil, nil, nil, nil}
+	}
+	if p.Free {
+		return []interface{}{true, nil, nil, nil, nil, nil}
+	}
+	args := []interface{}{false, p.Amount, p.Currency, nil, nil, nil}
+	if p.Discount != nil {
+		args[3], args[4], args[5] = p.Discount.Amount, p.Discount.StartsAt, p.Discount.EndsAt
+	}
+	return args
+}
+
+// active reports whether the discount applies at t
+func (d *PriceDiscount) active(t time.Time) bool {
+	if d == nil {
+		return false
+	}
+	if d.StartsAt != nil && t.Before(*d.StartsAt) {
+		return false
+	}
+	if d.EndsAt != nil && !t.Before(*d.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// localize fills in the current amount and the formatted prices for a locale
+func (p *CoursePricing) localize(locale string, now time.Time) {
+	if p == nil {
+		return
+	}
+	if p.Free {
+		p.Current, p.Formatted = 0, freeLabels[locale]
+		if p.Formatted == "" {
+			p.Formatted = freeLabels["en"]
+		}
+		return
+	}
+
+	p.Current = p.Amount
+	p.DiscountActive = p.Discount.active(now)
+	if p.DiscountActive {
+		p.Current = p.Amount - p.Discount.Amount
+		p.FormattedRegular = formatPrice(locale, p.Currency, p.Amount)
+	}
+	p.Formatted = formatPrice(locale, p.Currency, p.Current)
+}
+
+// formatPrice writes an amount in minor units the way the locale writes money, e.g.
+// "$1,234.50" in English and "1 234,50 ₴" in Ukrainian
+func formatPrice(locale, code string, minor int64) string {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return fmt.Sprintf("%d %s", minor, code)
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+
+	p := message.NewPrinter(language.Make(locale))
+	number := p.Sprintf(fmt.Sprintf("%%.%df", scale), float64(minor)/math.Pow10(scale))
+	symbol := p.Sprint(currency.NarrowSymbol(unit))
+	if symbolAfterAmount[locale] {
+		return number + " " + symbol
+	}
+	return symbol + number
+}
+
+// validCurrency reports whether code is an ISO 4217 currency
+func validCurrency(code string) bool {
+	_, err := currency.ParseISO(code)
+	return err == nil && len(code) == 3 && code == strings.ToUpper(code)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatPrice(t *testing.T) {
+	tests := []struct {
+		locale, code string
+		minor        int64
+		want         string
+	}{
+		{"en", "USD", 123450, "$1,234.50"},
+		{"en", "USD", 5, "$0.05"},
+		{"en", "EUR", 9900, "€99.00"},
+		{"uk", "UAH", 123450, "1\u00a0234,50\u00a0₴"},
+		{"en", "UAH", 50000, "₴500.00"},
+		// Currencies without minor units
+		{"en", "JPY", 1500, "¥1,500"},
+		{"en", "XYZ", 100, "100 XYZ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale+" "+tt.code, func(t *testing.T) {
+			if got := formatPrice(tt.locale, tt.code, tt.minor); got != tt.want {
+				t.Errorf("formatPrice(%q, %q, %d) = %q, want %q", tt.locale, tt.code, tt.minor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceDiscountActive(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		discount *PriceDiscount
+		want     bool
+	}{
+		{"no discount", nil, false},
+		{"open-ended", &PriceDiscount{Amount: 100}, true},
+		{"started", &PriceDiscount{Amount: 100, StartsAt: &before}, true},
+		{"not started yet", &PriceDiscount{Amount: 100, StartsAt: &after}, false},
+		{"starts right now", &PriceDiscount{Amount: 100, StartsAt: &now}, true},
+		{"ends later", &PriceDiscount{Amount: 100, EndsAt: &after}, true},
+		{"ended", &PriceDiscount{Amount: 100, EndsAt: &before}, false},
+		{"ends right now", &PriceDiscount{Amount: 100, EndsAt: &now}, false},
+		{"within the window", &PriceDiscount{Amount: 100, StartsAt: &before, EndsAt: &after}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.discount.active(now); got != tt.want {
+				t.Errorf("active = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoursePricingLocalize(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ended := now.Add(-time.Hour)
+
+	tests := []struct {
+		name          string
+		pricing       CoursePricing
+		locale        string
+		wantCurrent   int64
+		wantFormatted string
+		wantRegular   string
+	}{
+		{"free", CoursePricing{Free: true}, "uk", 0, "Безкоштовно", ""},
+		{"free in an unknown locale", CoursePricing{Free: true}, "de", 0, "Free", ""},
+		{"paid", CoursePricing{Amount: 100000, Currency: "UAH"}, "uk", 100000, "1\u00a0000,00\u00a0₴", ""},
+		{"active discount", CoursePricing{Amount: 10000, Currency: "USD", Discount: &PriceDiscount{Amount: 2500}}, "en",
+			7500, "$75.00", "$100.00"},
+		{"ended discount", CoursePricing{Amount: 10000, Currency: "USD", Discount: &PriceDiscount{Amount: 2500, EndsAt: &ended}}, "en",
+			10000, "$100.00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.pricing
+			p.localize(tt.locale, now)
+			if p.Current != tt.wantCurrent || p.Formatted != tt.wantFormatted || p.FormattedRegular != tt.wantRegular {
+				t.Errorf("got %d %q (regular %q), want %d %q (regular %q)",
+					p.Current, p.Formatted, p.FormattedRegular, tt.wantCurrent, tt.wantFormatted, tt.wantRegular)
+			}
+			if p.DiscountActive != (tt.wantRegular != "") {
+				t.Errorf("DiscountActive = %v", p.DiscountActive)
+			}
+		})
+	}
+}
+
+func TestValidCurrency(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"USD", true},
+		{"UAH", true},
+		{"usd", false},
+		{"US", false},
+		{"XYZ", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validCurrency(tt.code); got != tt.want {
+			t.Errorf("validCurrency(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
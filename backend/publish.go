@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	ArticleStatusDraft     = "draft"
+	ArticleStatusScheduled = "scheduled"
+	ArticleStatusPublished = "published"
+	ArticleStatusArchived  = "archived"
+)
+
+// publishedArticleFilter matches articles visible to the public. Scheduled articles whose time
+// has come are included even before the publisher has flipped them.
+const publishedArticleFilter = "(deleted_at IS NULL AND status IN ('published', 'scheduled') AND (publish_at IS NULL OR publish_at <= CURRENT_TIMESTAMP))"
+
+const schedulePublishInterval = time.Minute
+
+func isValidArticleStatus(status string) bool {
+	switch status {
+	case ArticleStatusDraft, ArticleStatusScheduled, ArticleStatusPublished, ArticleStatusArchived:
+		return true
+	}
+	return false
+}
+
+// normalizeArticleStatus validates status/publishAt of an article being saved
+func normalizeArticleStatus(a *Article) error {
+	if a.Status == "" {
+		a.Status = ArticleStatusPublished
+	}
+	if !isValidArticleStatus(a.Status) {
+		return fmt.Errorf("invalid status %q (expected draft, scheduled, published or archived)", a.Status)
+	}
+
+	switch a.Status {
+	case ArticleStatusScheduled:
+		if a.PublishAt == nil {
+			return fmt.Errorf("publishAt is required for scheduled articles")
+		}
+	case ArticleStatusPublished:
+		if a.PublishAt == nil {
+			now := time.Now()
+			a.PublishAt = &now
+		}
+	}
+	return nil
+}
+
+// isAdmin reports whether the request passed AuthMiddleware
+func isAdmin(r *http.Request) bool {
+	admin, _ := r.Context().Value("isAdmin").(bool)
+	return admin
+}
+
+// articleVisibility returns the WHERE condition limiting which articles the request may see
+func articleVisibility(r *http.Request) string {
+	if isAdmin(r) {
+		// Trashed articles are only listed in the trash
+		return "deleted_at IS NULL"
+	}
+	return publishedArticleFilter
+}
+
+// publishScheduledArticles flips scheduled articles whose publish time has passed. Each
+// flip is saved as a revision and audited without an actor. Rows locked by another
+// replica are skipped; it picks them up itself.
+func publishScheduledArticles() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		"SELECT id, title FROM articles WHERE status=$1 AND publish_at <= CURRENT_TIMESTAMP AND deleted_at IS NULL FOR UPDATE SKIP LOCKED",
+		ArticleStatusScheduled,
+	)
+	if err != nil {
+		return err
+	}
+	type due struct{ id, title string }
+	var articles []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.title); err != nil {
+			rows.Close()
+			return err
+		}
+		articles = append(articles, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range articles {
+		before, err := snapshotRow(tx, "articles", d.id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE articles SET status=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2", ArticleStatusPublished, d.id); err != nil {
+			return err
+		}
+		if _, err := saveRevision(tx, nil, articleRevisions, d.id, 0); err != nil {
+			return err
+		}
+		if err := auditRowChange(tx, nil, "article", "articles", d.id, "publish", before); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, d := range articles {
+		log.Printf("Published scheduled article %s (%q)", d.id, d.title)
+	}
+	return nil
+}
+
+// runSchedulePublisher publishes due articles every schedulePublishInterval until ctx is done
+func runSchedulePublisher(ctx context.Context) {
+	ticker := time.NewTicker(schedulePublishInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := publishScheduledArticles(); err != nil {
+			log.Printf("Error publishing scheduled articles: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// revisionKind describes how the versions of one content type are stored
+type revisionKind struct {
+	entityType string   // name used in the audit log
+	label      string   // name used in error messages
+	table      string   // content table
+	revTable   string   // revision table
+	fk         string   // revision column referencing the content row
+	fields     []string // columns copied into each revision
+	restorable []string // columns written back on restore
+}
+
+var articleRevisions = revisionKind{
+	entityType: "article",
+	label:      "Article",
+	table:      "articles",
+	revTable:   "article_revisions",
+	fk:         "article_id",
+	fields:     []string{"title", "slug", "excerpt", "content", "author", "date", "category", "featured", "image", "status", "publish_at"},
+	// Slug and status stay as they are, so a restore neither breaks links nor (un)publishes.
+	// The category stays too: the revision only has its name, which may have been renamed or deleted since.
+	restorable: []string{"title", "excerpt", "content", "author", "date", "featured", "image"},
+}
+
+var courseRevisions = revisionKind{
+	entityType: "course",
+	label:      "Course",
+	table:      "courses",
+	revTable:   "course_revisions",
+	fk:         "course_id",
+	fields: []string{"title", "description", "lessons", "duration", "enroll_link", "category", "tags", "image",
+		"price_free", "price_amount", "price_currency", "discount_amount", "discount_starts_at", "discount_ends_at"},
+	restorable: []string{"title", "description", "lessons", "duration", "enroll_link", "tags", "image",
+		"price_free", "price_amount", "price_currency", "discount_amount", "discount_starts_at", "discount_ends_at"},
+}
+
+type Revision struct {
+	ID             string                 `json:"id"`
+	Revision       int                    `json:"revision"`
+	Title          string                 `json:"title"`
+	CreatedBy      string                 `json:"createdBy,omitempty"`
+	CreatedByEmail string                 `json:"createdByEmail,omitempty"`
+	RestoredFrom   *int                   `json:"restoredFrom"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	Fields         map[string]interface{} `json:"fields,omitempty"`
+}
+
+type DiffOp struct {
+	Op   string `json:"op"` // equal, insert or delete
+	Text string `json:"text"`
+}
+
+type FieldDiff struct {
+	Field   string   `json:"field"`
+	Ops     []DiffOp `json:"ops"`
+	Unified string   `json:"unified"`
+}
+
+// saveRevision stores the current state of a row as its next revision
+func saveRevision(tx *sql.Tx, r *http.Request, k revisionKind, id string, restoredFrom int) (int, error) {
+	userID, email := requestActor(r)
+	cols := strings.Join(k.fields, ", ")
+
+	var revision int
+	err := tx.QueryRow(
+		"INSERT INTO "+k.revTable+" ("+k.fk+", revision, "+cols+", created_by, created_by_email, restored_from) "+
+			"SELECT id, COALESCE((SELECT MAX(revision) FROM "+k.revTable+" WHERE "+k.fk+"=$1), 0) + 1, "+cols+", NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, 0) "+
+			"FROM "+k.table+" WHERE id=$1 RETURNING revision",
+		id, userID, email, restoredFrom,
+	).Scan(&revision)
+	return revision, err
+}
+
+const revisionColumns = "id, revision, title, COALESCE(created_by, ''), COALESCE(created_by_email, ''), restored_from, created_at"
+
+func scanRevision(row rowScanner, dest ...interface{}) (Revision, error) {
+	var rev Revision
+	var restoredFrom sql.NullInt64
+	err := row.Scan(append([]interface{}{&rev.ID, &rev.Revision, &rev.Title, &rev.CreatedBy, &rev.CreatedByEmail, &restoredFrom, &rev.CreatedAt}, dest...)...)
+	if restoredFrom.Valid {
+		n := int(restoredFrom.Int64)
+		rev.RestoredFrom = &n
+	}
+	return rev, err
+}
+
+// loadRevision returns one revision including its content fields
+func loadRevision(k revisionKind, id string, revision int) (Revision, error) {
+	var raw []byte
+	rev, err := scanRevision(db.QueryRow(
+		"SELECT "+revisionColumns+", to_jsonb(t) FROM "+k.revTable+" t WHERE "+k.fk+"::text=$1 AND revision=$2",
+		id, revision,
+	), &raw)
+	if err != nil {
+		return rev, err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return rev, err
+	}
+	rev.Fields = map[string]interface{}{}
+	for _, f := range k.fields {
+		rev.Fields[f] = all[f]
+	}
+	return rev, nil
+}
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request, k revisionKind) {
+	id := mux.Vars(r)["id"]
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM "+k.table+" WHERE id::text=$1)", id).Scan(&exists); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, k.label+" not found")
+		return
+	}
+
+	rows, err := db.Query("SELECT "+revisionColumns+" FROM "+k.revTable+" WHERE "+k.fk+"=$1 ORDER BY revision DESC", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func (s *Server) getRevision(w http.ResponseWriter, r *http.Request, k revisionKind) {
+	params := mux.Vars(r)
+	revision, _ := strconv.Atoi(params["rev"])
+
+	rev, err := loadRevision(k, params["id"], revision)
+	if err != nil {
+		revisionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
+
+// diffRevisions compares two revisions field by field. ?to defaults to the latest
+// revision and ?from to the one before it.
+func (s *Server) diffRevisions(w http.ResponseWriter, r *http.Request, k revisionKind) {
+	id := mux.Vars(r)["id"]
+	q := r.URL.Query()
+
+	to, err := strconv.Atoi(q.Get("to"))
+	if q.Get("to") == "" {
+		err = db.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM "+k.revTable+" WHERE "+k.fk+"::text=$1", id).Scan(&to)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid to")
+		return
+	}
+
+	from, err := strconv.Atoi(q.Get("from"))
+	if q.Get("from") == "" {
+		from = to - 1
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid from")
+		return
+	}
+
+	older, err := loadRevision(k, id, from)
+	if err != nil {
+		revisionError(w, err)
+		return
+	}
+	newer, err := loadRevision(k, id, to)
+	if err != nil {
+		revisionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":   older,
+		"to":     newer,
+		"fields": diffRevisionFields(k, older, newer),
+	})
+}
+
+func revisionError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Revision not found")
+	} else {
+		writeInternalError(w, err)
+	}
+}
+
+func diffRevisionFields(k revisionKind, older, newer Revision) []FieldDiff {
+	dmp := diffmatchpatch.New()
+	diffs := []FieldDiff{}
+
+	for _, f := range k.fields {
+		a, b := fieldText(older.Fields[f]), fieldText(newer.Fields[f])
+		if a == b {
+			continue
+		}
+
+		// Diff whole lines, which reads better for prose than a character diff
+		ca, cb, lines := dmp.DiffLinesToChars(a, b)
+		changes := dmp.DiffCharsToLines(dmp.DiffMain(ca, cb, false), lines)
+
+		fd := FieldDiff{Field: f, Ops: []DiffOp{}}
+		var unified strings.Builder
+		for _, c := range changes {
+			op, prefix := "equal", "  "
+			switch c.Type {
+			case diffmatchpatch.DiffInsert:
+				op, prefix = "insert", "+ "
+			case diffmatchpatch.DiffDelete:
+				op, prefix = "delete", "- "
+			}
+			fd.Ops = append(fd.Ops, DiffOp{Op: op, Text: c.Text})
+			for _, line := range strings.SplitAfter(c.Text, "\n") {
+				if line == "" {
+					continue
+				}
+				unified.WriteString(prefix + line)
+				if !strings.HasSuffix(line, "\n") {
+					unified.WriteString("\n")
+				}
+			}
+		}
+		fd.Unified = unified.String()
+		diffs = append(diffs, fd)
+	}
+	return diffs
+}
+
+// fieldText renders a revision value for diffing; lists get one item per line
+func fieldText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []interface{}:
+		items := make([]string, len(t))
+		for i, item := range t {
+			items[i] = fieldText(item)
+		}
+		return strings.Join(items, "\n")
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// restoreRevision copies an old revision back onto the content and saves the result as
+// a new revision, so the restore itself can be undone
+func (s *Server) restoreRevision(w http.ResponseWriter, r *http.Request, k revisionKind) {
+	params := mux.Vars(r)
+	id := params["id"]
+	revision, _ := strconv.Atoi(params["rev"])
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, k.table, id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	sets := make([]string, len(k.restorable))
+	for i, f := range k.restorable {
+		sets[i] = f + "=rev." + f
+	}
+	res, err := tx.Exec(
+		"UPDATE "+k.table+" t SET "+strings.Join(sets, ", ")+", updated_at=CURRENT_TIMESTAMP FROM "+k.revTable+" rev "+
+			"WHERE t.id::text=$1 AND rev."+k.fk+"=t.id AND rev.revision=$2",
+		id, revision,
+	)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	newRevision, err := saveRevision(tx, r, k, id, revision)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := auditRowChange(tx, r, k.entityType, k.table, id, "restore", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"revision":     newRevision,
+		"restoredFrom": revision,
+	})
+}
+
+func (s *Server) getArticleRevisions(w http.ResponseWriter, r *http.Request) {
+	s.listRevisions(w, r, articleRevisions)
+}
+
+func (s *Server) getArticleRevision(w http.ResponseWriter, r *http.Request) {
+	s.getRevision(w, r, articleRevisions)
+}
+
+func (s *Server) diffArticleRevisions(w http.ResponseWriter, r *http.Request) {
+	s.diffRevisions(w, r, articleRevisions)
+}
+
+func (s *Server) restoreArticleRevision(w http.ResponseWriter, r *http.Request) {
+	if ok, err := canEditArticle(r, mux.Vars(r)["id"]); err != nil {
+		writeInternalError(w, err)
+		return
+	} else if !ok {
+		writeError(w, http.StatusForbidden, "Access denied: authors may only edit their own articles")
+		return
+	}
+	s.restoreRevision(w, r, articleRevisions)
+}
+
+func (s *Server) getCourseRevisions(w http.ResponseWriter, r *http.Request) {
+	s.listRevisions(w, r, courseRevisions)
+}
+
+func (s *Server) getCourseRevision(w http.ResponseWriter, r *http.Request) {
+	s.getRevision(w, r, courseRevisions)
+}
+
+func (s *Server) diffCourseRevisions(w http.ResponseWriter, r *http.Request) {
+	s.diffRevisions(w, r, courseRevisions)
+}
+
+func (s *Server) restoreCourseRevision(w http.ResponseWriter, r *http.Request) {
+	s.restoreRevision(w, r, courseRevisions)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+	RoleViewer = "viewer"
+)
+
+type Permission string
+
+const (
+	PermContentRead      Permission = "content:read"     // admin listings, drafts, media library
+	PermArticlesWrite    Permission = "articles:write"   // create articles and edit one's own
+	PermArticlesEditAny  Permission = "articles:editAny" // edit and delete anyone's articles
+	PermContentWrite     Permission = "content:write"    // courses, projects, certificates, categories
+	PermCategoriesDelete Permission = "categories:delete"
+	PermMediaUpload      Permission = "media:upload"
+	PermMediaDelete      Permission = "media:delete"
+	PermUsersManage      Permission = "users:manage"
+	PermAuditRead        Permission = "audit:read"
+	PermMessagesManage   Permission = "messages:manage" // contact inbox and outgoing email
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleViewer: {PermContentRead},
+	RoleAuthor: {PermContentRead, PermArticlesWrite, PermMediaUpload},
+	RoleEditor: {PermContentRead, PermArticlesWrite, PermArticlesEditAny, PermContentWrite, PermMediaUpload, PermMediaDelete,
+		PermMessagesManage},
+	RoleOwner: {PermContentRead, PermArticlesWrite, PermArticlesEditAny, PermContentWrite, PermCategoriesDelete,
+		PermMediaUpload, PermMediaDelete, PermUsersManage, PermAuditRead, PermMessagesManage},
+}
+
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func roleHas(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func requestRole(r *http.Request) string {
+	role, _ := r.Context().Value("role").(string)
+	return role
+}
+
+func hasPermission(r *http.Request, perm Permission) bool {
+	return roleHas(requestRole(r), perm)
+}
+
+// requirePermission wraps an admin handler so it only runs for roles holding perm
+func (s *Server) requirePermission(perm Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasPermission(r, perm) {
+			email, _ := r.Context().Value("email").(string)
+			log.Printf("Access DENIED: %s (%s) lacks %s for %s %s", email, requestRole(r), perm, r.Method, r.URL.Path)
+			writeError(w, http.StatusForbidden, "Access denied: your role does not allow this action")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// canEditArticle reports whether the request may change the article. Authors are limited
+// to the articles they created.
+func canEditArticle(r *http.Request, id string) (bool, error) {
+	if hasPermission(r, PermArticlesEditAny) {
+		return true, nil
+	}
+	if !hasPermission(r, PermArticlesWrite) {
+		return false, nil
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	var own bool
+	err := db.QueryRow("SELECT COALESCE(created_by = $2, false) FROM articles WHERE id=$1", id, userID).Scan(&own)
+	if err == sql.ErrNoRows {
+		// Let the handler answer with its usual 404
+		return true, nil
+	}
+	return own, err
+}
+
+const roleCacheTTL = 30 * time.Second
+
+type cachedRole struct {
+	role    string
+	expires time.Time
+}
+
+// Roles are cached briefly so most requests do not hit the database
+var roleCache = struct {
+	sync.RWMutex
+	entries map[string]cachedRole
+}{entries: map[string]cachedRole{}}
+
+func invalidateRoleCache() {
+	roleCache.Lock()
+	roleCache.entries = map[string]cachedRole{}
+	roleCache.Unlock()
+}
+
+// resolveRole finds the admin role of a signed-in Firebase user. The admin_users table
+// decides when it has a row for the user (a revoked row denies access); otherwise a
+// "role" custom claim on the token is used. An empty role means no access.
+func resolveRole(uid, email string, claims map[string]interface{}) (string, error) {
+	roleCache.RLock()
+	cached, ok := roleCache.entries[uid]
+	roleCache.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.role, nil
+	}
+
+	verified, _ := claims["email_verified"].(bool)
+	role, err := lookupRole(uid, email, verified)
+	if err != nil {
+		return "", err
+	}
+	if role == nil {
+		claim, _ := claims["role"].(string)
+		if validRole(claim) {
+			role = &claim
+		} else {
+			role = new(string)
+		}
+	}
+
+	roleCache.Lock()
+	roleCache.entries[uid] = cachedRole{role: *role, expires: time.Now().Add(roleCacheTTL)}
+	roleCache.Unlock()
+	return *role, nil
+}
+
+// lookupRole returns nil when admin_users has no row for the user, and an empty
+// role when the user's access was revoked. Rows are matched by email, and invitations
+// linked, only when Firebase verified the email; anyone can create an unverified
+// account with someone else's address.
+func lookupRole(uid, email string, emailVerified bool) (*string, error) {
+	var id, role, linkedUID string
+	var revoked bool
+	err := db.QueryRow(
+		"SELECT id, role, revoked_at IS NOT NULL, COALESCE(firebase_uid, '') FROM admin_users WHERE firebase_uid=$1 OR ($3 AND email=$2) ORDER BY (firebase_uid IS NOT DISTINCT FROM $1) DESC LIMIT 1",
+		uid, email, emailVerified,
+	).Scan(&id, &role, &revoked, &linkedUID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return new(string), nil
+	}
+
+	// An invitation is tied to the Firebase account on its first sign-in
+	if linkedUID == "" {
+		if _, err := db.Exec("UPDATE admin_users SET firebase_uid=$1, last_login_at=CURRENT_TIMESTAMP WHERE id=$2", uid, id); err != nil {
+			return nil, err
+		}
+	} else if linkedUID != uid {
+		log.Printf("Security alert: %s signed in with UID %s but is linked to another account", email, uid)
+		return new(string), nil
+	} else {
+		db.Exec("UPDATE admin_users SET last_login_at=CURRENT_TIMESTAMP WHERE id=$1", id)
+	}
+	return &role, nil
+}
+
+// seedOwnersFromEnv turns the legacy ADMIN_EMAILS list into owners, so existing
+// deployments keep working after the switch to admin_users. Users already in the
+// table (including revoked ones) are left alone.
+func seedOwnersFromEnv() error {
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			continue
+		}
+		_, err := db.Exec(
+			"INSERT INTO admin_users (email, role, invited_by) VALUES ($1, $2, 'ADMIN_EMAILS') ON CONFLICT (email) DO NOTHING",
+			email, RoleOwner,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+
+	// ts_headline markers, swapped for <mark> after the snippet is HTML-escaped
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+type SearchResult struct {
+	Type    string  `json:"type"` // "article" or "course"
+	ID      string  `json:"id"`
+	Slug    string  `json:"slug,omitempty"`
+	Title   string  `json:"title"`
+	Image   string  `json:"image"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// prefixTsquery turns free text into a to_tsquery expression matching every word as a prefix,
+// which stands in for stemming in languages without a stemmer
+func prefixTsquery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// searchQuery returns the tsquery SQL expression for the requested language and the
+// text search configuration used for highlighting
+func searchQuery(lang, q string, args *sqlArgs) (expr, headlineConfig string) {
+	switch lang {
+	case "en":
+		return "websearch_to_tsquery('wellness_en', " + args.add(q) + ")", "wellness_en"
+	case "uk":
+		return "to_tsquery('wellness_simple', " + args.add(prefixTsquery(q)) + ")", "wellness_simple"
+	default:
+		return "(websearch_to_tsquery('wellness_en', " + args.add(q) + ") || to_tsquery('wellness_simple', " + args.add(prefixTsquery(q)) + "))", "wellness_simple"
+	}
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if prefixTsquery(q) == "" {
+		writeError(w, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	lang := r.URL.Query().Get("lang")
+	if lang != "" && lang != "en" && lang != "uk" {
+		writeError(w, http.StatusBadRequest, "Invalid lang (expected en or uk)")
+		return
+	}
+
+	var args sqlArgs
+	tsquery, headlineConfig := searchQuery(lang, q, &args)
+	headlineOpts := "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+
+	query := `WITH q AS (SELECT ` + tsquery + ` AS query),
+		hits AS (
+			SELECT 'article' AS type, id, COALESCE(slug, '') AS slug, title, COALESCE(image, '') AS image,
+				ts_rank_cd(search_vector, q.query) AS rank, COALESCE(excerpt, '') || E'\n' || content AS body
+			FROM articles, q
+			WHERE search_vector @@ q.query AND ` + articleVisibility(r) + `
+			UNION ALL
+			SELECT 'course', id, '', title, COALESCE(image, ''),
+				ts_rank_cd(search_vector, q.query), COALESCE(description, '') || E'\n' || COALESCE(array_to_string(tags, ', '), '')
+			FROM courses, q
+			WHERE search_vector @@ q.query AND deleted_at IS NULL
+			ORDER BY rank DESC
+			LIMIT ` + args.add(limit) + `
+		)
+		SELECT hits.type, hits.id, hits.slug, hits.title, hits.image, hits.rank,
+			ts_headline('` + headlineConfig + `', hits.body, q.query, ` + args.add(headlineOpts) + `)
+		FROM hits, q
+		ORDER BY hits.rank DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var res SearchResult
+		if err := rows.Scan(&res.Type, &res.ID, &res.Slug, &res.Title, &res.Image, &res.Rank, &res.Snippet); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		res.Snippet = highlightSnippet(res.Snippet)
+
+		// Fallback for missing image
+		if res.Image == "" {
+			res.Image = "/images/blog-1.png"
+			if res.Type == "course" {
+				res.Image = "/images/service-1.png"
+			}
+		}
+
+		results = append(results, res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   q,
+		"results": results,
+	})
+}
+
+// highlightSnippet escapes a ts_headline fragment and turns the markers into <mark> tags
+func highlightSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, highlightStart, "<mark>")
+	return strings.ReplaceAll(s, highlightStop, "</mark>")
+}
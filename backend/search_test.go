@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrefixTsquery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"yoga", "yoga:*"},
+		{"  morning   yoga ", "morning:* & yoga:*"},
+		{"йога для початківців", "йога:* & для:* & початківців:*"},
+		{"covid-19", "covid:* & 19:*"},
+		// tsquery operators and quotes are dropped, so input can't change the query structure
+		{"yoga & !pilates | (tai:chi)", "yoga:* & pilates:* & tai:* & chi:*"},
+		{"it's", "it:* & s:*"},
+		{"'); DROP TABLE articles; --", "DROP:* & TABLE:* & articles:*"},
+		{"", ""},
+		{"&|!:*()", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			if got := prefixTsquery(tt.q); got != tt.want {
+				t.Errorf("prefixTsquery(%q) = %q, want %q", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		lang     string
+		wantExpr string
+		wantCfg  string
+		wantArgs []interface{}
+	}{
+		{"en", "websearch_to_tsquery('wellness_en', $1)", "wellness_en", []interface{}{"morning yoga"}},
+		{"uk", "to_tsquery('wellness_simple', $1)", "wellness_simple", []interface{}{"morning:* & yoga:*"}},
+		{"", "(websearch_to_tsquery('wellness_en', $1) || to_tsquery('wellness_simple', $2))", "wellness_simple",
+			[]interface{}{"morning yoga", "morning:* & yoga:*"}},
+	}
+	for _, tt := range tests {
+		t.Run("lang="+tt.lang, func(t *testing.T) {
+			var args sqlArgs
+			expr, cfg := searchQuery(tt.lang, "morning yoga", &args)
+			if expr != tt.wantExpr || cfg != tt.wantCfg {
+				t.Errorf("searchQuery = %q, %q; want %q, %q", expr, cfg, tt.wantExpr, tt.wantCfg)
+			}
+			if len(args) != len(tt.wantArgs) {
+				t.Fatalf("args = %v, want %v", args, tt.wantArgs)
+			}
+			for i := range args {
+				if args[i] != tt.wantArgs[i] {
+					t.Errorf("args[%d] = %v, want %v", i, args[i], tt.wantArgs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	got := highlightSnippet("<b>" + highlightStart + "yoga" + highlightStop + " & more</b>")
+	want := "&lt;b&gt;<mark>yoga</mark> &amp; more&lt;/b&gt;"
+	if got != want {
+		t.Errorf("highlightSnippet = %q, want %q", got, want)
+	}
+}
+
+func TestSearchRejectsEmptyQuery(t *testing.T) {
+	for _, q := range []string{"", "%20%20", "%26%7C%21"} {
+		rec := httptest.NewRecorder()
+		(&Server{}).handleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?q="+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("q=%s: status = %d, want 400", q, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Ukrainian national transliteration (KMU 2010), plus a few Russian letters.
+// Letters in cyrillicInitial are spelled differently at the start of a word.
+var cyrillicTranslit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "h", 'ґ': "g", 'д': "d", 'е': "e", 'є': "ie",
+	'ж': "zh", 'з': "z", 'и': "y", 'і': "i", 'ї': "i", 'й': "i", 'к': "k", 'л': "l",
+	'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ь': "", 'ю': "iu",
+	'я': "ia", 'ы': "y", 'э': "e", 'ё': "io", 'ъ': "",
+	'\'': "", '’': "", 'ʼ': "",
+}
+
+var cyrillicInitial = map[rune]string{
+	'є': "ye", 'ї': "yi", 'й': "y", 'ю': "yu", 'я': "ya",
+}
+
+const maxSlugLength = 80
+
+// slugify turns a title into a lowercase ASCII, hyphen-separated URL slug
+func slugify(s string) string {
+	if slug := transliterate(s); slug != "" {
+		return slug
+	}
+	return "article"
+}
+
+// transliterate lowercases s, transliterates Cyrillic to Latin and joins the words with hyphens.
+// The result is empty when s has no letters or digits.
+func transliterate(s string) string {
+	runes := []rune(strings.ToLower(s))
+
+	var b strings.Builder
+	wordStart := true
+	for i, r := range runes {
+		if tr, ok := cyrillicTranslit[r]; ok {
+			if initial, ok := cyrillicInitial[r]; ok && wordStart {
+				tr = initial
+			}
+			// "зг" is written "zgh" so it is not read as "ж"
+			if r == 'г' && i > 0 && runes[i-1] == 'з' {
+				tr = "gh"
+			}
+			b.WriteString(tr)
+			wordStart = false
+			continue
+		}
+
+		// Strip accents from Latin letters (é -> e)
+		for _, d := range norm.NFD.String(string(r)) {
+			if unicode.Is(unicode.Mn, d) {
+				continue
+			}
+			if (d >= 'a' && d <= 'z') || (d >= '0' && d <= '9') {
+				b.WriteRune(d)
+				wordStart = false
+			} else {
+				b.WriteByte('-')
+				wordStart = true
+			}
+		}
+	}
+
+	// Collapse separators
+	parts := strings.FieldsFunc(b.String(), func(r rune) bool { return r == '-' })
+	slug := strings.Join(parts, "-")
+
+	if len(slug) > maxSlugLength {
+		// Drop a word cut in half, unless that would lose most of the slug
+		midWord := slug[maxSlugLength-1] != '-' && slug[maxSlugLength] != '-'
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+		if i := strings.LastIndexByte(slug, '-'); midWord && i > maxSlugLength/2 {
+			slug = slug[:i]
+		}
+	}
+
+	return slug
+}
+
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// uniqueArticleSlug returns base, or base-2, base-3, ... so that it is not used by another article,
+// either as its current slug or in its slug history
+func uniqueArticleSlug(q querier, base, articleID string) (string, error) {
+	for n := 1; ; n++ {
+		candidate := base
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		var taken bool
+		err := q.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM articles WHERE slug=$1 AND id::text<>$2)
+				OR EXISTS (SELECT 1 FROM article_slug_history WHERE slug=$1 AND article_id::text<>$2)`,
+			candidate, articleID,
+		).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// backfillArticleSlugs assigns slugs to articles created before slugs existed. It runs as
+// part of migration 0002.
+func backfillArticleSlugs(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, title FROM articles WHERE slug IS NULL OR slug = ''")
+	if err != nil {
+		return err
+	}
+
+	type pending struct{ id, title string }
+	var articles []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.title); err != nil {
+			rows.Close()
+			return err
+		}
+		articles = append(articles, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range articles {
+		slug, err := uniqueArticleSlug(tx, slugify(p.title), p.id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE articles SET slug=$1 WHERE id=$2", slug, p.id); err != nil {
+			return err
+		}
+	}
+
+	if len(articles) > 0 {
+		log.Printf("Generated slugs for %d articles", len(articles))
+	}
+	return nil
+}
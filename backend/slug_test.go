@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Go   1.22 released  ", "go-1-22-released"},
+		{"Café au lait", "cafe-au-lait"},
+		{"Привіт, світ", "pryvit-svit"},
+		{"Згода", "zghoda"},
+		{"Їжак і ялинка", "yizhak-i-yalynka"},
+		{"Київ", "kyiv"},
+		{"Юлія", "yuliia"},
+		{"Львів’янка", "lvivianka"},
+		{"Щука", "shchuka"},
+		{"Єнот", "yenot"},
+		{"Ёлка", "iolka"},
+		{"!!!", "article"},
+		{"", "article"},
+		{"🙂", "article"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := slugify(tt.title); got != tt.want {
+				t.Errorf("slugify(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlugifyLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{"cut at a word boundary", strings.Repeat("word ", 30), strings.TrimSuffix(strings.Repeat("word-", 16), "-")},
+		{"half a word is dropped", strings.Repeat("words ", 20), strings.TrimSuffix(strings.Repeat("words-", 13), "-")},
+		{"one long word is cut hard", strings.Repeat("a", 100), strings.Repeat("a", maxSlugLength)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slugify(tt.title)
+			if got != tt.want {
+				t.Errorf("slugify(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+			if len(got) > maxSlugLength || strings.HasSuffix(got, "-") {
+				t.Errorf("slugify(%q) = %q: longer than %d or ends with a hyphen", tt.title, got, maxSlugLength)
+			}
+		})
+	}
+}
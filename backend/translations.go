@@ -0,0 +1,819 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"golang.org/x/text/language"
+)
+
+// Locales content can be translated into. Content rows hold the default locale.
+var supportedLocales = []string{"en", "uk"}
+
+func validLocale(locale string) bool {
+	for _, l := range supportedLocales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultLocale is the locale of the untranslated content, set with DEFAULT_LOCALE
+func defaultLocale() string {
+	if l := os.Getenv("DEFAULT_LOCALE"); validLocale(l) {
+		return l
+	}
+	return "en"
+}
+
+// negotiateLocale picks the locale of a public response: ?lang= first, then the best
+// Accept-Language match, then the default locale. Admin requests ignore Accept-Language so
+// edit forms always load the default locale. An unsupported ?lang= answers 400.
+func negotiateLocale(w http.ResponseWriter, r *http.Request) (string, bool) {
+	locale := defaultLocale()
+	if v := r.URL.Query().Get("lang"); v != "" {
+		if !validLocale(v) {
+			writeError(w, http.StatusBadRequest, "Invalid lang (expected "+strings.Join(supportedLocales, " or ")+")")
+			return "", false
+		}
+		locale = v
+	} else if !isAdmin(r) {
+		locale = matchAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	return locale, true
+}
+
+func matchAcceptLanguage(header string) string {
+	def := defaultLocale()
+	if header == "" {
+		return def
+	}
+	preferred, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(preferred) == 0 {
+		return def
+	}
+
+	// The matcher falls back to its first tag, so the default locale goes first
+	locales := []string{def}
+	for _, l := range supportedLocales {
+		if l != def {
+			locales = append(locales, l)
+		}
+	}
+	tags := make([]language.Tag, len(locales))
+	for i, l := range locales {
+		tags[i] = language.Make(l)
+	}
+
+	_, index, confidence := language.NewMatcher(tags).Match(preferred...)
+	if confidence == language.No {
+		return def
+	}
+	return locales[index]
+}
+
+// translatedField is a column that has a per-locale version
+type translatedField struct {
+	column string
+	json   string
+	maxLen int
+	list   bool // TEXT[] column
+}
+
+// translationKind describes the translations of one content type
+type translationKind struct {
+	entityType  string
+	table       string
+	titleColumn string
+	trTable     string
+	fk          string
+	fields      []translatedField
+	writePerm   Permission
+}
+
+// Keyed by the {type} used in the translation API, which is also the audit log entity type
+var translationKinds = map[string]translationKind{
+	"article": {
+		entityType: "article", table: "articles", titleColumn: "title",
+		trTable: "article_translations", fk: "article_id", writePerm: PermArticlesWrite,
+		fields: []translatedField{
+			{column: "title", json: "title", maxLen: 200},
+			{column: "excerpt", json: "excerpt", maxLen: 1000},
+			{column: "content", json: "content", maxLen: 200000},
+		},
+	},
+	"course": {
+		entityType: "course", table: "courses", titleColumn: "title",
+		trTable: "course_translations", fk: "course_id", writePerm: PermContentWrite,
+		fields: []translatedField{
+			{column: "title", json: "title", maxLen: 200},
+			{column: "description", json: "description", maxLen: 5000},
+			{column: "lessons", json: "lessons", maxLen: 100},
+			{column: "duration", json: "duration", maxLen: 100},
+			{column: "tags", json: "tags", maxLen: 50, list: true},
+		},
+	},
+	"project": {
+		entityType: "project", table: "projects", titleColumn: "title",
+		trTable: "project_translations", fk: "project_id", writePerm: PermContentWrite,
+		fields: []translatedField{
+			{column: "title", json: "title", maxLen: 200},
+			{column: "description", json: "description", maxLen: 2000},
+			{column: "detail", json: "detail", maxLen: 10000},
+			{column: "link_label", json: "linkLabel", maxLen: 100},
+		},
+	},
+	"certificate": {
+		entityType: "certificate", table: "certificates", titleColumn: "title",
+		trTable: "certificate_translations", fk: "certificate_id", writePerm: PermContentWrite,
+		fields: []translatedField{
+			{column: "title", json: "title", maxLen: 200},
+			{column: "issuer", json: "issuer", maxLen: 200},
+		},
+	},
+	"category": {
+		entityType: "category", table: "categories", titleColumn: "name",
+		trTable: "category_translations", fk: "category_id", writePerm: PermContentWrite,
+		fields: []translatedField{
+			{column: "name", json: "name", maxLen: 100},
+		},
+	},
+}
+
+// Listing order of the translation types
+var translationKindNames = []string{"article", "course", "project", "certificate", "category"}
+
+func (k translationKind) columnList(alias string) string {
+	cols := make([]string, len(k.fields))
+	for i, f := range k.fields {
+		cols[i] = alias + "." + f.column
+	}
+	return strings.Join(cols, ", ")
+}
+
+// translationValues holds the non-empty translated fields of a row by column
+type translationValues map[string]interface{}
+
+func (t translationValues) apply(column string, dst *string) {
+	if v, ok := t[column].(string); ok {
+		*dst = v
+	}
+}
+
+func (t translationValues) applyList(column string, dst *[]string) {
+	if v, ok := t[column].([]string); ok {
+		*dst = v
+	}
+}
+
+// byJSON keys the values by their JSON field names
+func (t translationValues) byJSON(k translationKind) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, f := range k.fields {
+		if v, ok := t[f.column]; ok {
+			out[f.json] = v
+		}
+	}
+	return out
+}
+
+// missing lists the JSON names of fields that have text in base but not in t
+func (t translationValues) missing(k translationKind, base translationValues) []string {
+	missing := []string{}
+	for _, f := range k.fields {
+		_, inBase := base[f.column]
+		_, inT := t[f.column]
+		if inBase && !inT {
+			missing = append(missing, f.json)
+		}
+	}
+	return missing
+}
+
+// translationDest returns scan destinations for the columns of k.columnList and a
+// function reading the scanned values
+func translationDest(k translationKind) ([]interface{}, func() translationValues) {
+	strs := make([]sql.NullString, len(k.fields))
+	lists := make([]pq.StringArray, len(k.fields))
+	dest := make([]interface{}, len(k.fields))
+	for i, f := range k.fields {
+		if f.list {
+			dest[i] = &lists[i]
+		} else {
+			dest[i] = &strs[i]
+		}
+	}
+
+	return dest, func() translationValues {
+		values := translationValues{}
+		for i, f := range k.fields {
+			if f.list {
+				if len(lists[i]) > 0 {
+					values[f.column] = []string(lists[i])
+				}
+			} else if strings.TrimSpace(strs[i].String) != "" {
+				values[f.column] = strs[i].String
+			}
+		}
+		return values
+	}
+}
+
+// scanTranslationValues scans the columns of k.columnList after the given leading columns
+func scanTranslationValues(k translationKind, row rowScanner, leading ...interface{}) (translationValues, error) {
+	dest, values := translationDest(k)
+	if err := row.Scan(append(leading, dest...)...); err != nil {
+		return nil, err
+	}
+	return values(), nil
+}
+
+// loadTranslations returns the translations into locale of the given rows, keyed by row id
+func loadTranslations(k translationKind, locale string, ids []string) (map[string]translationValues, error) {
+	out := map[string]translationValues{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	rows, err := db.Query(
+		"SELECT t."+k.fk+", "+k.columnList("t")+" FROM "+k.trTable+" t WHERE t.locale=$1 AND t."+k.fk+" = ANY($2::uuid[])",
+		locale, pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		values, err := scanTranslationValues(k, rows, &id)
+		if err != nil {
+			return nil, err
+		}
+		out[id] = values
+	}
+	return out, rows.Err()
+}
+
+// categoryNames returns the names of categories translated into locale
+func categoryNames(locale string, ids []string) (map[string]string, error) {
+	trs, err := loadTranslations(translationKinds["category"], locale, ids)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	for id, t := range trs {
+		if name, ok := t["name"].(string); ok {
+			names[id] = name
+		}
+	}
+	return names, nil
+}
+
+// translateArticles replaces the translated fields of articles, and the names of their
+// categories, with their version in locale. Fields without a translation keep the
+// default locale.
+func translateArticles(locale string, articles []Article) error {
+	if locale == defaultLocale() || len(articles) == 0 {
+		return nil
+	}
+	ids := make([]string, len(articles))
+	var categoryIDs []string
+	for i, a := range articles {
+		ids[i] = a.ID
+		if a.CategoryID != "" {
+			categoryIDs = append(categoryIDs, a.CategoryID)
+		}
+	}
+
+	trs, err := loadTranslations(translationKinds["article"], locale, ids)
+	if err != nil {
+		return err
+	}
+	names, err := categoryNames(locale, categoryIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range articles {
+		a := &articles[i]
+		t := trs[a.ID]
+		t.apply("title", &a.Title)
+		t.apply("excerpt", &a.Excerpt)
+		t.apply("content", &a.Content)
+		if name, ok := names[a.CategoryID]; ok {
+			a.Category = name
+			a.CategoryRef.Name = name
+		}
+	}
+	return nil
+}
+
+func translateArticle(locale string, a *Article) error {
+	articles := []Article{*a}
+	err := translateArticles(locale, articles)
+	*a = articles[0]
+	return err
+}
+
+func translateCourses(locale string, courses []Course) error {
+	if locale == defaultLocale() || len(courses) == 0 {
+		return nil
+	}
+	ids := make([]string, len(courses))
+	var categoryIDs []string
+	for i, c := range courses {
+		ids[i] = c.ID
+		if c.CategoryID != "" {
+			categoryIDs = append(categoryIDs, c.CategoryID)
+		}
+	}
+
+	trs, err := loadTranslations(translationKinds["course"], locale, ids)
+	if err != nil {
+		return err
+	}
+	names, err := categoryNames(locale, categoryIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range courses {
+		c := &courses[i]
+		t := trs[c.ID]
+		t.apply("title", &c.Title)
+		t.apply("description", &c.Description)
+		t.apply("lessons", &c.Lessons)
+		t.apply("duration", &c.Duration)
+		t.applyList("tags", &c.Tags)
+		if name, ok := names[c.CategoryID]; ok {
+			c.Category = name
+			c.CategoryRef.Name = name
+		}
+	}
+	return nil
+}
+
+func translateProjects(locale string, projects []Project) error {
+	if locale == defaultLocale() || len(projects) == 0 {
+		return nil
+	}
+	ids := make([]string, len(projects))
+	for i, p := range projects {
+		ids[i] = p.ID
+	}
+	trs, err := loadTranslations(translationKinds["project"], locale, ids)
+	if err != nil {
+		return err
+	}
+	for i := range projects {
+		p := &projects[i]
+		t := trs[p.ID]
+		t.apply("title", &p.Title)
+		t.apply("description", &p.Description)
+		t.apply("detail", &p.Detail)
+		t.apply("link_label", &p.LinkLabel)
+	}
+	return nil
+}
+
+func translateCertificates(locale string, certs []Certificate) error {
+	if locale == defaultLocale() || len(certs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(certs))
+	for i, c := range certs {
+		ids[i] = c.ID
+	}
+	trs, err := loadTranslations(translationKinds["certificate"], locale, ids)
+	if err != nil {
+		return err
+	}
+	for i := range certs {
+		c := &certs[i]
+		t := trs[c.ID]
+		t.apply("title", &c.Title)
+		t.apply("issuer", &c.Issuer)
+	}
+	return nil
+}
+
+func translateCategories(locale string, categories []Category) error {
+	if locale == defaultLocale() || len(categories) == 0 {
+		return nil
+	}
+	ids := make([]string, len(categories))
+	for i, c := range categories {
+		ids[i] = c.ID
+	}
+	names, err := categoryNames(locale, ids)
+	if err != nil {
+		return err
+	}
+	for i := range categories {
+		if name, ok := names[categories[i].ID]; ok {
+			categories[i].Name = name
+		}
+	}
+	return nil
+}
+
+type Translation struct {
+	Locale    string                 `json:"locale"`
+	Default   bool                   `json:"default"`
+	Fields    map[string]interface{} `json:"fields"`
+	Missing   []string               `json:"missing"`
+	UpdatedAt *time.Time             `json:"updatedAt,omitempty"`
+}
+
+// translationTarget resolves the {type} and {id} of a translation route, answering 404
+// when either is unknown. base holds the default locale fields of the row.
+func translationTarget(w http.ResponseWriter, r *http.Request) (k translationKind, id string, base translationValues, ok bool) {
+	params := mux.Vars(r)
+	k, found := translationKinds[params["type"]]
+	if !found {
+		writeError(w, http.StatusNotFound, "Unknown type "+params["type"])
+		return k, "", nil, false
+	}
+	id = params["id"]
+
+	base, err := scanTranslationValues(k, db.QueryRow("SELECT "+k.columnList("b")+" FROM "+k.table+" b WHERE b.id=$1 AND b.deleted_at IS NULL", id))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Item not found")
+		return k, "", nil, false
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return k, "", nil, false
+	}
+	return k, id, base, true
+}
+
+// getTranslations lists every supported locale of an item, the default locale first
+func (s *Server) getTranslations(w http.ResponseWriter, r *http.Request) {
+	k, id, base, ok := translationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query("SELECT t.locale, t.updated_at, "+k.columnList("t")+" FROM "+k.trTable+" t WHERE t."+k.fk+"=$1", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	type stored struct {
+		values    translationValues
+		updatedAt time.Time
+	}
+	byLocale := map[string]stored{}
+	for rows.Next() {
+		var locale string
+		var updatedAt time.Time
+		values, err := scanTranslationValues(k, rows, &locale, &updatedAt)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		byLocale[locale] = stored{values, updatedAt}
+	}
+
+	def := defaultLocale()
+	translations := []Translation{{Locale: def, Default: true, Fields: base.byJSON(k), Missing: []string{}}}
+	for _, locale := range supportedLocales {
+		if locale == def {
+			continue
+		}
+		t := Translation{Locale: locale, Fields: map[string]interface{}{}, Missing: translationValues{}.missing(k, base)}
+		if st, ok := byLocale[locale]; ok {
+			updatedAt := st.updatedAt
+			t.Fields = st.values.byJSON(k)
+			t.Missing = st.values.missing(k, base)
+			t.UpdatedAt = &updatedAt
+		}
+		translations = append(translations, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":          k.entityType,
+		"id":            id,
+		"defaultLocale": def,
+		"translations":  translations,
+	})
+}
+
+// translationLocale checks the {locale} of a write. The default locale lives on the
+// content row and is edited there.
+func translationLocale(w http.ResponseWriter, r *http.Request) (string, bool) {
+	locale := mux.Vars(r)["locale"]
+	if !validLocale(locale) {
+		writeError(w, http.StatusNotFound, "Unsupported locale "+locale)
+		return "", false
+	}
+	if locale == defaultLocale() {
+		writeError(w, http.StatusBadRequest, "The default locale is edited on the item itself")
+		return "", false
+	}
+	return locale, true
+}
+
+// canEditTranslation applies the write permission of the translated content type
+func canEditTranslation(w http.ResponseWriter, r *http.Request, k translationKind, id string) bool {
+	if !hasPermission(r, k.writePerm) {
+		writeError(w, http.StatusForbidden, "Access denied: your role does not allow this action")
+		return false
+	}
+	if k.entityType == "article" {
+		if ok, err := canEditArticle(r, id); err != nil {
+			writeInternalError(w, err)
+			return false
+		} else if !ok {
+			writeError(w, http.StatusForbidden, "Access denied: authors may only translate their own articles")
+			return false
+		}
+	}
+	return true
+}
+
+// putTranslation replaces the translation of an item into one locale. Fields left out
+// fall back to the default locale.
+func (s *Server) putTranslation(w http.ResponseWriter, r *http.Request) {
+	k, id, base, ok := translationTarget(w, r)
+	if !ok {
+		return
+	}
+	locale, ok := translationLocale(w, r)
+	if !ok {
+		return
+	}
+	if !canEditTranslation(w, r, k, id) {
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	args := []interface{}{id, locale}
+	errs := FieldErrors{}
+	known := map[string]bool{}
+	for _, f := range k.fields {
+		known[f.json] = true
+		raw, present := body[f.json]
+		if f.list {
+			var list []string
+			if present && json.Unmarshal(raw, &list) != nil {
+				errs.add(f.json, "must be a list of strings")
+			}
+			if len(list) > 20 {
+				errs.add(f.json, "must have at most 20 entries")
+			}
+			for _, v := range list {
+				errs.maxLen(f.json, v, f.maxLen)
+			}
+			args = append(args, pq.Array(list))
+		} else {
+			var v string
+			if present && json.Unmarshal(raw, &v) != nil {
+				errs.add(f.json, "must be a string")
+			}
+			errs.maxLen(f.json, v, f.maxLen)
+			args = append(args, sql.NullString{String: v, Valid: strings.TrimSpace(v) != ""})
+		}
+	}
+	for key := range body {
+		if !known[key] {
+			errs.add(key, "is not a translatable field")
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	cols := make([]string, len(k.fields))
+	placeholders := make([]string, len(k.fields))
+	updates := make([]string, len(k.fields))
+	for i, f := range k.fields {
+		cols[i] = f.column
+		placeholders[i] = "$" + strconv.Itoa(i+3)
+		updates[i] = f.column + "=EXCLUDED." + f.column
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var before map[string]interface{}
+	var existingID string
+	err = tx.QueryRow("SELECT id FROM "+k.trTable+" WHERE "+k.fk+"=$1 AND locale=$2", id, locale).Scan(&existingID)
+	if err == nil {
+		if before, err = snapshotRow(tx, k.trTable, existingID); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	} else if err != sql.ErrNoRows {
+		writeInternalError(w, err)
+		return
+	}
+
+	var trID string
+	var updatedAt time.Time
+	err = tx.QueryRow(
+		"INSERT INTO "+k.trTable+" ("+k.fk+", locale, "+strings.Join(cols, ", ")+") VALUES ($1, $2, "+strings.Join(placeholders, ", ")+")"+
+			" ON CONFLICT ("+k.fk+", locale) DO UPDATE SET "+strings.Join(updates, ", ")+", updated_at=CURRENT_TIMESTAMP RETURNING id, updated_at",
+		args...,
+	).Scan(&trID, &updatedAt)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	action := "create"
+	if before != nil {
+		action = "update"
+	}
+	if err := auditRowChange(tx, r, k.entityType+"_translation", k.trTable, trID, action, before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	values, err := scanTranslationValues(k, tx.QueryRow("SELECT "+k.columnList("t")+" FROM "+k.trTable+" t WHERE t.id=$1", trID))
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Translation{
+		Locale:    locale,
+		Fields:    values.byJSON(k),
+		Missing:   values.missing(k, base),
+		UpdatedAt: &updatedAt,
+	})
+}
+
+func (s *Server) deleteTranslation(w http.ResponseWriter, r *http.Request) {
+	k, id, _, ok := translationTarget(w, r)
+	if !ok {
+		return
+	}
+	locale, ok := translationLocale(w, r)
+	if !ok {
+		return
+	}
+	if !canEditTranslation(w, r, k, id) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var trID string
+	err = tx.QueryRow("SELECT id FROM "+k.trTable+" WHERE "+k.fk+"=$1 AND locale=$2", id, locale).Scan(&trID)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Translation not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	before, err := snapshotRow(tx, k.trTable, trID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM "+k.trTable+" WHERE id=$1", trID); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if err := auditRowChange(tx, r, k.entityType+"_translation", k.trTable, trID, "delete", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type MissingTranslation struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Locale  string   `json:"locale"`
+	Missing []string `json:"missing"`
+}
+
+// getMissingTranslations reports, per item and locale, the fields that have text in the
+// default locale but no translation. ?type and ?locale narrow the report.
+func (s *Server) getMissingTranslations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	names := translationKindNames
+	if v := q.Get("type"); v != "" {
+		if _, ok := translationKinds[v]; !ok {
+			writeError(w, http.StatusBadRequest, "Unknown type "+v)
+			return
+		}
+		names = []string{v}
+	}
+
+	def := defaultLocale()
+	var locales []string
+	if v := q.Get("locale"); v != "" {
+		if !validLocale(v) || v == def {
+			writeError(w, http.StatusBadRequest, "Invalid locale "+v)
+			return
+		}
+		locales = []string{v}
+	} else {
+		for _, l := range supportedLocales {
+			if l != def {
+				locales = append(locales, l)
+			}
+		}
+	}
+
+	items := []MissingTranslation{}
+	summary := map[string]map[string]int{}
+	for _, name := range names {
+		k := translationKinds[name]
+		summary[name] = map[string]int{}
+		for _, locale := range locales {
+			summary[name][locale] = 0
+		}
+
+		rows, err := db.Query(
+			"SELECT b.id, b."+k.titleColumn+", l.locale, "+k.columnList("b")+", "+k.columnList("t")+
+				" FROM "+k.table+" b CROSS JOIN unnest($1::text[]) AS l(locale)"+
+				" LEFT JOIN "+k.trTable+" t ON t."+k.fk+" = b.id AND t.locale = l.locale"+
+				" WHERE b.deleted_at IS NULL ORDER BY b.created_at, l.locale",
+			pq.Array(locales),
+		)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+
+		baseDest, baseValues := translationDest(k)
+		trDest, trValues := translationDest(k)
+		for rows.Next() {
+			var item MissingTranslation
+			dest := append([]interface{}{&item.ID, &item.Title, &item.Locale}, baseDest...)
+			if err := rows.Scan(append(dest, trDest...)...); err != nil {
+				rows.Close()
+				writeInternalError(w, err)
+				return
+			}
+			item.Type = name
+			item.Missing = trValues().missing(k, baseValues())
+			if len(item.Missing) > 0 {
+				items = append(items, item)
+				summary[name][item.Locale]++
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":   items,
+		"summary": summary,
+	})
+}
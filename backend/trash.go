@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultTrashRetentionDays = 30
+	trashPurgeInterval        = time.Hour
+)
+
+// trashType describes a content type that is soft-deleted
+type trashType struct {
+	table       string
+	titleColumn string
+	restorePerm Permission
+}
+
+// Keyed by the {type} used in the trash API, which is also the audit log entity type
+var trashTypes = map[string]trashType{
+	"article":     {table: "articles", titleColumn: "title", restorePerm: PermArticlesWrite},
+	"course":      {table: "courses", titleColumn: "title", restorePerm: PermContentWrite},
+	"project":     {table: "projects", titleColumn: "title", restorePerm: PermContentWrite},
+	"certificate": {table: "certificates", titleColumn: "title", restorePerm: PermContentWrite},
+	"category":    {table: "categories", titleColumn: "name", restorePerm: PermContentWrite},
+}
+
+// Listing order of the trash types
+var trashTypeNames = []string{"article", "course", "project", "certificate", "category"}
+
+type TrashItem struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+// trashRetention is how long trashed items are kept, set in days with TRASH_RETENTION_DAYS
+func trashRetention() time.Duration {
+	days := defaultTrashRetentionDays
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// getTrash lists soft-deleted items, most recently deleted first. ?type limits the listing to one type.
+func (s *Server) getTrash(w http.ResponseWriter, r *http.Request) {
+	names := trashTypeNames
+	if v := r.URL.Query().Get("type"); v != "" {
+		if _, ok := trashTypes[v]; !ok {
+			writeError(w, http.StatusBadRequest, "Unknown type "+v)
+			return
+		}
+		names = []string{v}
+	}
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		t := trashTypes[name]
+		parts[i] = fmt.Sprintf("SELECT '%s' AS type, id, %s AS title, deleted_at FROM %s WHERE deleted_at IS NOT NULL", name, t.titleColumn, t.table)
+	}
+
+	rows, err := db.Query(strings.Join(parts, " UNION ALL ") + " ORDER BY deleted_at DESC")
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	retention := trashRetention()
+	items := []TrashItem{}
+	for rows.Next() {
+		var item TrashItem
+		if err := rows.Scan(&item.Type, &item.ID, &item.Title, &item.DeletedAt); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		item.PurgeAt = item.DeletedAt.Add(retention)
+		items = append(items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func (s *Server) restoreFromTrash(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	typeName, id := params["type"], params["id"]
+
+	t, ok := trashTypes[typeName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown type "+typeName)
+		return
+	}
+	if !hasPermission(r, t.restorePerm) {
+		writeError(w, http.StatusForbidden, "Access denied: your role does not allow this action")
+		return
+	}
+	if typeName == "article" {
+		if ok, err := canEditArticle(r, id); err != nil {
+			writeInternalError(w, err)
+			return
+		} else if !ok {
+			writeError(w, http.StatusForbidden, "Access denied: authors may only restore their own articles")
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotRow(tx, t.table, id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if msg, err := restoreConflict(tx, typeName, id); err != nil {
+		writeInternalError(w, err)
+		return
+	} else if msg != "" {
+		writeError(w, http.StatusConflict, msg)
+		return
+	}
+
+	res, err := tx.Exec("UPDATE "+t.table+" SET deleted_at=NULL WHERE id::text=$1 AND deleted_at IS NOT NULL", id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		writeError(w, http.StatusConflict, "Can't restore: it conflicts with an existing "+typeName)
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "Item not found in trash")
+		return
+	}
+
+	if err := auditRowChange(tx, r, typeName, t.table, id, "restore", before); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreConflict explains why a trashed item can't be restored yet: content whose
+// category is still in the trash, or a category whose name was taken in the meantime.
+// It returns "" when the item can be restored.
+func restoreConflict(tx *sql.Tx, typeName, id string) (string, error) {
+	if typeName == "category" {
+		var name, categoryType string
+		err := tx.QueryRow("SELECT name, type FROM categories WHERE id::text=$1 AND deleted_at IS NOT NULL FOR UPDATE", id).Scan(&name, &categoryType)
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if taken, err := categoryNameTaken(tx, name, categoryType, id); err != nil || !taken {
+			return "", err
+		}
+		return fmt.Sprintf("A %s category named %q already exists; rename or delete it before restoring this one", categoryType, name), nil
+	}
+
+	for _, content := range categoryContents {
+		if content.entityType != typeName {
+			continue
+		}
+		var name string
+		err := tx.QueryRow(
+			"SELECT c.name FROM "+content.table+" t JOIN categories c ON c.id=t.category_id WHERE t.id::text=$1 AND c.deleted_at IS NOT NULL",
+			id,
+		).Scan(&name)
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Its category %q is in the trash; restore the category first", name), nil
+	}
+	return "", nil
+}
+
+// purgeTrash permanently deletes items trashed longer than the retention window. Each
+// purge is recorded in the audit log without an actor.
+func purgeTrash() error {
+	cutoff := time.Now().Add(-trashRetention())
+	for _, name := range trashTypeNames {
+		t := trashTypes[name]
+		if name == "category" {
+			// Trashed content may still be filed under a category about to be purged
+			for _, content := range categoryContents {
+				_, err := db.Exec(
+					"UPDATE "+content.table+" SET category_id=NULL, category='' WHERE category_id IN (SELECT id FROM categories WHERE deleted_at < $1)",
+					cutoff,
+				)
+				if err != nil {
+					return fmt.Errorf("detaching %s from purged categories: %w", content.table, err)
+				}
+			}
+		}
+		res, err := db.Exec(
+			`WITH purged AS (
+				DELETE FROM `+t.table+` t WHERE deleted_at < $1 RETURNING t.id, t.`+t.titleColumn+` AS title
+			)
+			INSERT INTO audit_log (entity_type, entity_id, action, changes)
+			SELECT $2, id::text, 'purge', jsonb_build_object('`+t.titleColumn+`', jsonb_build_object('from', title, 'to', NULL))
+			FROM purged`,
+			cutoff, name,
+		)
+		if err != nil {
+			return fmt.Errorf("purging %s: %w", t.table, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Purged %d %s from the trash", n, t.table)
+		}
+	}
+	return nil
+}
+
+// runTrashPurger purges the trash once at startup and then every hour
+func runTrashPurger(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := purgeTrash(); err != nil {
+			log.Printf("Error purging trash: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func isUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// FieldErrors maps a JSON field name to what is wrong with it
+type FieldErrors map[string]string
+
+// add keeps the first problem found for a field
+func (e FieldErrors) add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+func (e FieldErrors) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		e.add(field, "is required")
+	}
+}
+
+func (e FieldErrors) maxLen(field, value string, n int) {
+	if utf8.RuneCountInString(value) > n {
+		e.add(field, fmt.Sprintf("must be at most %d characters", n))
+	}
+}
+
+func (e FieldErrors) oneOf(field, value string, options ...string) {
+	for _, o := range options {
+		if value == o {
+			return
+		}
+	}
+	e.add(field, "must be one of "+strings.Join(options, ", "))
+}
+
+// url accepts an empty value, an absolute http(s) URL or a site-relative path
+func (e FieldErrors) url(field, value string) {
+	if value == "" {
+		return
+	}
+	e.maxLen(field, value, 2048)
+	if strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.add(field, "must be an http(s) URL or a path starting with /")
+	}
+}
+
+// email accepts an empty value or a bare address such as name@example.com
+func (e FieldErrors) email(field, value string) {
+	if value == "" {
+		return
+	}
+	e.maxLen(field, value, 254)
+	if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+		e.add(field, "must be a valid email address")
+	}
+}
+
+// Percent-encoded CR and LF, which some tools decode on the way to a mail header
+var encodedLineBreak = regexp.MustCompile(`(?i)%0[ad]`)
+
+// singleLine rejects line breaks and other control characters, for values that end up
+// in email headers. Encoded line breaks and RFC 2047 encoded words are rejected as well.
+func (e FieldErrors) singleLine(field, value string) {
+	switch {
+	case hasControlChars(value), encodedLineBreak.MatchString(value):
+		e.add(field, "must be a single line of text")
+	case strings.Contains(value, "=?") && strings.Contains(value, "?="):
+		e.add(field, "must not contain encoded words (=?...?=)")
+	}
+}
+
+func (e FieldErrors) uuid(field, value string) {
+	if value != "" && !isUUID(value) {
+		e.add(field, "must be a UUID")
+	}
+}
+
+func (e FieldErrors) date(field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		e.add(field, "must be a date in YYYY-MM-DD format")
+	}
+}
+
+// validateIDParam rejects malformed {id} and {somethingId} route variables before they
+// reach the database
+func validateIDParam(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range mux.Vars(r) {
+			if (name == "id" || strings.HasSuffix(name, "Id")) && !isUUID(value) {
+				writeAPIError(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidID, Message: "Invalid " + name + ": expected a UUID"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateIDList checks the ids of a reorder request
+func validateIDList(ids []string) FieldErrors {
+	errs := FieldErrors{}
+	for i, id := range ids {
+		if !isUUID(id) {
+			errs.add(fmt.Sprintf("[%d]", i), "must be a UUID")
+		}
+	}
+	return errs
+}
+
+func validateArticle(a *Article, requireStatus bool) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("title", a.Title)
+	errs.maxLen("title", a.Title, 200)
+	errs.maxLen("slug", a.Slug, 80)
+	errs.maxLen("excerpt", a.Excerpt, 1000)
+	errs.required("content", a.Content)
+	errs.maxLen("content", a.Content, 200000)
+	errs.maxLen("author", a.Author, 100)
+	errs.date("date", a.Date)
+	errs.maxLen("category", a.Category, 100)
+	errs.uuid("categoryId", a.CategoryID)
+	errs.url("image", a.Image)
+
+	if a.Status != "" || requireStatus {
+		status := a.Status
+		if status == "" {
+			status = ArticleStatusPublished
+		}
+		errs.oneOf("status", status, ArticleStatusDraft, ArticleStatusScheduled, ArticleStatusPublished, ArticleStatusArchived)
+		if status == ArticleStatusScheduled && a.PublishAt == nil {
+			errs.add("publishAt", "is required for scheduled articles")
+		}
+	}
+	return errs
+}
+
+func validateCourse(c *Course) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("title", c.Title)
+	errs.maxLen("title", c.Title, 200)
+	errs.maxLen("description", c.Description, 5000)
+	errs.maxLen("lessons", c.Lessons, 100)
+	errs.maxLen("duration", c.Duration, 100)
+	errs.maxLen("enrollLink", c.EnrollLink, 500)
+	if c.Capacity != nil && (*c.Capacity < 1 || *c.Capacity > 100000) {
+		errs.add("capacity", "must be between 1 and 100000, or null for no limit")
+	}
+	if p := c.Pricing; p != nil && !p.Free {
+		if !validCurrency(p.Currency) {
+			errs.add("pricing.currency", "must be an ISO 4217 code such as USD or UAH")
+		}
+		if p.Amount <= 0 {
+			errs.add("pricing.amount", "must be greater than 0 for a paid course; set free instead")
+		}
+		if d := p.Discount; d != nil {
+			if d.Amount <= 0 || d.Amount >= p.Amount {
+				errs.add("pricing.discount.amount", "must be greater than 0 and less than the amount")
+			}
+			if d.StartsAt != nil && d.EndsAt != nil && !d.StartsAt.Before(*d.EndsAt) {
+				errs.add("pricing.discount.endsAt", "must be after startsAt")
+			}
+		}
+	}
+	if p := c.Pricing; p != nil && p.Free && p.Discount != nil {
+		errs.add("pricing.discount", "a free course cannot have a discount")
+	}
+	errs.maxLen("category", c.Category, 100)
+	errs.uuid("categoryId", c.CategoryID)
+	errs.url("image", c.Image)
+	if len(c.Tags) > 20 {
+		errs.add("tags", "must have at most 20 tags")
+	}
+	for i, tag := range c.Tags {
+		errs.required(fmt.Sprintf("tags[%d]", i), tag)
+		errs.maxLen(fmt.Sprintf("tags[%d]", i), tag, 50)
+	}
+	return errs
+}
+
+func validateCourseModule(m *CourseModule) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("title", m.Title)
+	errs.maxLen("title", m.Title, 200)
+	return errs
+}
+
+func validateCourseLesson(l *CourseLesson) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("title", l.Title)
+	errs.maxLen("title", l.Title, 200)
+	errs.uuid("moduleId", l.ModuleID)
+	if l.DurationMinutes < 0 || l.DurationMinutes > 10000 {
+		errs.add("durationMinutes", "must be between 0 and 10000")
+	}
+	return errs
+}
+
+func validateContact(c *ContactRequest) FieldErrors {
+	errs := FieldErrors{}
+	errs.maxLen("name", c.Name, 100)
+	errs.singleLine("name", c.Name)
+	errs.email("email", c.Email)
+	errs.maxLen("subject", c.Subject, 200)
+	errs.singleLine("subject", c.Subject)
+	errs.maxLen("message", c.Message, 10000)
+	return errs
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()./-]*[0-9]$`)
+
+func validateEnrollment(e *EnrollmentRequest) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("name", e.Name)
+	errs.maxLen("name", e.Name, 100)
+	errs.required("email", e.Email)
+	errs.email("email", e.Email)
+	errs.maxLen("phone", e.Phone, 30)
+	if e.Phone != "" && !phonePattern.MatchString(e.Phone) {
+		errs.add("phone", "must be a phone number")
+	}
+	return errs
+}
+
+func validateCategory(c *Category) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("name", c.Name)
+	errs.maxLen("name", c.Name, 100)
+	errs.oneOf("type", c.Type, "blog", "course")
+	return errs
+}
+
+func validateProject(p *Project) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("title", p.Title)
+	errs.maxLen("title", p.Title, 200)
+	errs.maxLen("description", p.Description, 2000)
+	errs.maxLen("detail", p.Detail, 10000)
+	errs.maxLen("linkLabel", p.LinkLabel, 100)
+	errs.url("linkHref", p.LinkHref)
+	errs.url("image", p.Image)
+	return errs
+}
+
+func validateCertificate(c *Certificate) FieldErrors {
+	errs := FieldErrors{}
+	errs.required("title", c.Title)
+	errs.maxLen("title", c.Title, 200)
+	errs.required("issuer", c.Issuer)
+	errs.maxLen("issuer", c.Issuer, 200)
+	errs.required("year", c.Year)
+	errs.maxLen("year", c.Year, 20)
+	errs.url("image", c.Image)
+	return errs
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestFieldErrorValidators(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(e FieldErrors)
+		want  string // expected message, empty when the value is valid
+	}{
+		{"required empty", func(e FieldErrors) { e.required("f", "") }, "is required"},
+		{"required blank", func(e FieldErrors) { e.required("f", " \t ") }, "is required"},
+		{"required set", func(e FieldErrors) { e.required("f", "x") }, ""},
+		{"maxLen counts runes", func(e FieldErrors) { e.maxLen("f", "їжак", 4) }, ""},
+		{"maxLen over", func(e FieldErrors) { e.maxLen("f", "abcde", 4) }, "must be at most 4 characters"},
+		{"oneOf match", func(e FieldErrors) { e.oneOf("f", "blog", "blog", "course") }, ""},
+		{"oneOf miss", func(e FieldErrors) { e.oneOf("f", "Blog", "blog", "course") }, "must be one of blog, course"},
+		{"url empty", func(e FieldErrors) { e.url("f", "") }, ""},
+		{"url path", func(e FieldErrors) { e.url("f", "/images/a.png") }, ""},
+		{"url https", func(e FieldErrors) { e.url("f", "https://example.com/a.png") }, ""},
+		{"url protocol-relative", func(e FieldErrors) { e.url("f", "//evil.example.com/a.png") }, "must be an http(s) URL or a path starting with /"},
+		{"url javascript", func(e FieldErrors) { e.url("f", "javascript:alert(1)") }, "must be an http(s) URL or a path starting with /"},
+		{"url without host", func(e FieldErrors) { e.url("f", "https://") }, "must be an http(s) URL or a path starting with /"},
+		{"email empty", func(e FieldErrors) { e.email("f", "") }, ""},
+		{"email bare", func(e FieldErrors) { e.email("f", "a@example.com") }, ""},
+		{"email with name", func(e FieldErrors) { e.email("f", "A <a@example.com>") }, "must be a valid email address"},
+		{"email invalid", func(e FieldErrors) { e.email("f", "not-an-email") }, "must be a valid email address"},
+		{"uuid empty", func(e FieldErrors) { e.uuid("f", "") }, ""},
+		{"uuid valid", func(e FieldErrors) { e.uuid("f", "3F1C2A4E-8B7D-4C21-9E0F-1A2B3C4D5E6F") }, ""},
+		{"uuid invalid", func(e FieldErrors) { e.uuid("f", "3f1c2a4e") }, "must be a UUID"},
+		{"date empty", func(e FieldErrors) { e.date("f", "") }, ""},
+		{"date valid", func(e FieldErrors) { e.date("f", "2024-02-29") }, ""},
+		{"date impossible", func(e FieldErrors) { e.date("f", "2023-02-29") }, "must be a date in YYYY-MM-DD format"},
+		{"date other format", func(e FieldErrors) { e.date("f", "29.02.2024") }, "must be a date in YYYY-MM-DD format"},
+		{"singleLine plain", func(e FieldErrors) { e.singleLine("f", "Запис на курс") }, ""},
+		{"singleLine tab", func(e FieldErrors) { e.singleLine("f", "a\tb") }, "must be a single line of text"},
+		{"singleLine encoded LF", func(e FieldErrors) { e.singleLine("f", "a%0Ab") }, "must be a single line of text"},
+		{"singleLine lone =?", func(e FieldErrors) { e.singleLine("f", "what=?") }, ""},
+		{"first error wins", func(e FieldErrors) { e.required("f", ""); e.maxLen("f", "", 0); e.add("f", "other") }, "is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := FieldErrors{}
+			tt.check(errs)
+			if errs["f"] != tt.want {
+				t.Errorf("error = %q, want %q", errs["f"], tt.want)
+			}
+			if tt.want == "" && len(errs) > 0 {
+				t.Errorf("unexpected errors %v", errs)
+			}
+		})
+	}
+}
+
+func TestValidateArticle(t *testing.T) {
+	publishAt := time.Now()
+	valid := func() Article {
+		return Article{Title: "Title", Content: "Body"}
+	}
+
+	tests := []struct {
+		name          string
+		edit          func(a *Article)
+		requireStatus bool
+		wantFields    []string
+	}{
+		{"minimal, without a date", func(a *Article) {}, false, nil},
+		{"with a date", func(a *Article) { a.Date = "2024-05-06" }, false, nil},
+		{"bad date", func(a *Article) { a.Date = "May 6" }, false, []string{"date"}},
+		{"missing title and content", func(a *Article) { a.Title, a.Content = "", "" }, false, []string{"title", "content"}},
+		{"long slug", func(a *Article) { a.Slug = strings.Repeat("a", 81) }, false, []string{"slug"}},
+		{"bad category id", func(a *Article) { a.CategoryID = "blog" }, false, []string{"categoryId"}},
+		{"bad image", func(a *Article) { a.Image = "data:image/png;base64,AAAA" }, false, []string{"image"}},
+		{"unknown status", func(a *Article) { a.Status = "live" }, false, []string{"status"}},
+		{"scheduled without a time", func(a *Article) { a.Status = ArticleStatusScheduled }, false, []string{"publishAt"}},
+		{"scheduled", func(a *Article) { a.Status, a.PublishAt = ArticleStatusScheduled, &publishAt }, false, nil},
+		{"status defaults to published", func(a *Article) {}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := valid()
+			tt.edit(&a)
+			assertFields(t, validateArticle(&a, tt.requireStatus), tt.wantFields)
+		})
+	}
+}
+
+func TestValidateCoursePricing(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	capacity := func(n int) *int { return &n }
+
+	tests := []struct {
+		name       string
+		course     Course
+		wantFields []string
+	}{
+		{"no pricing", Course{Title: "Yoga"}, nil},
+		{"free", Course{Title: "Yoga", Pricing: &CoursePricing{Free: true}}, nil},
+		{"paid", Course{Title: "Yoga", Pricing: &CoursePricing{Amount: 1000, Currency: "UAH"}}, nil},
+		{"lowercase currency", Course{Title: "Yoga", Pricing: &CoursePricing{Amount: 1000, Currency: "uah"}}, []string{"pricing.currency"}},
+		{"unknown currency", Course{Title: "Yoga", Pricing: &CoursePricing{Amount: 1000, Currency: "XYZ"}}, []string{"pricing.currency"}},
+		{"paid without an amount", Course{Title: "Yoga", Pricing: &CoursePricing{Currency: "USD"}}, []string{"pricing.amount"}},
+		{"discount too large", Course{Title: "Yoga", Pricing: &CoursePricing{Amount: 1000, Currency: "USD",
+			Discount: &PriceDiscount{Amount: 1000}}}, []string{"pricing.discount.amount"}},
+		{"discount ends before it starts", Course{Title: "Yoga", Pricing: &CoursePricing{Amount: 1000, Currency: "USD",
+			Discount: &PriceDiscount{Amount: 100, StartsAt: &end, EndsAt: &start}}}, []string{"pricing.discount.endsAt"}},
+		{"free with a discount", Course{Title: "Yoga", Pricing: &CoursePricing{Free: true,
+			Discount: &PriceDiscount{Amount: 100}}}, []string{"pricing.discount"}},
+		{"zero capacity", Course{Title: "Yoga", Capacity: capacity(0)}, []string{"capacity"}},
+		{"too many tags", Course{Title: "Yoga", Tags: strings.Split(strings.Repeat("t,", 20)+"t", ",")}, []string{"tags"}},
+		{"empty tag", Course{Title: "Yoga", Tags: []string{"ok", ""}}, []string{"tags[1]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFields(t, validateCourse(&tt.course), tt.wantFields)
+		})
+	}
+}
+
+func TestValidateEnrollment(t *testing.T) {
+	tests := []struct {
+		phone string
+		valid bool
+	}{
+		{"", true},
+		{"+380 44 123-45-67", true},
+		{"044 123.45.67", true},
+		{"call me", false},
+		{"+", false},
+		{"123-", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phone, func(t *testing.T) {
+			errs := validateEnrollment(&EnrollmentRequest{Name: "Olena", Email: "olena@example.com", Phone: tt.phone})
+			if (errs["phone"] == "") != tt.valid {
+				t.Errorf("phone %q: errors %v, want valid=%v", tt.phone, errs, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateIDParam(t *testing.T) {
+	router := mux.NewRouter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	router.Handle("/courses/{id}/lessons/{lessonId}", validateIDParam(ok))
+	router.Handle("/articles/by-slug/{slug}", validateIDParam(ok))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/courses/3f1c2a4e-8b7d-4c21-9e0f-1a2b3c4d5e6f/lessons/3f1c2a4e-8b7d-4c21-9e0f-1a2b3c4d5e6f", http.StatusNoContent},
+		{"/courses/42/lessons/3f1c2a4e-8b7d-4c21-9e0f-1a2b3c4d5e6f", http.StatusBadRequest},
+		{"/courses/3f1c2a4e-8b7d-4c21-9e0f-1a2b3c4d5e6f/lessons/42", http.StatusBadRequest},
+		{"/articles/by-slug/not-a-uuid", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+// assertFields checks that exactly the wanted fields have errors
+func assertFields(t *testing.T, errs FieldErrors, want []string) {
+	t.Helper()
+	for _, f := range want {
+		if errs[f] == "" {
+			t.Errorf("no error for %s (errors: %v)", f, errs)
+		}
+	}
+	if len(errs) != len(want) {
+		t.Errorf("errors = %v, want only %v", errs, want)
+	}
+}
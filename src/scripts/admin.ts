@@ -282,6 +282,34 @@ const loadCourses = async () => {
   } catch (error) { showStatus('Error loading courses', true); }
 };
 
+// Prices are entered in major units (49.00) and stored in minor units (4900)
+const toMinor = (value: FormDataEntryValue | null) => Math.round(Number(value) * 100);
+const fromMinor = (value?: number) => (value === undefined ? '' : (value / 100).toFixed(2));
+const toISO = (value: FormDataEntryValue | null) => (value ? new Date(value.toString()).toISOString() : undefined);
+const toLocalInput = (value?: string) => {
+  if (!value) return '';
+  const d = new Date(value);
+  return new Date(d.getTime() - d.getTimezoneOffset() * 60000).toISOString().slice(0, 16);
+};
+
+const readCoursePricing = (formData: FormData): api.CoursePricing | null => {
+  if (formData.get('priceFree') === 'on') return { free: true, amount: 0, currency: '' };
+  if (!formData.get('priceAmount')?.toString().trim()) return null;
+  const pricing: api.CoursePricing = {
+    free: false,
+    amount: toMinor(formData.get('priceAmount')),
+    currency: formData.get('priceCurrency')?.toString() || 'UAH',
+  };
+  if (formData.get('discountAmount')?.toString().trim()) {
+    pricing.discount = {
+      amount: toMinor(formData.get('discountAmount')),
+      startsAt: toISO(formData.get('discountStartsAt')),
+      endsAt: toISO(formData.get('discountEndsAt')),
+    };
+  }
+  return pricing;
+};
+
 const saveCourse = async (e: Event) => {
   e.preventDefault();
   if (!auth.currentUser) return;
@@ -294,7 +322,11 @@ const saveCourse = async (e: Event) => {
     lessons: formData.get('lessons')?.toString().trim() || '',
     duration: formData.get('duration')?.toString().trim() || '',
     enrollLink: formData.get('enrollLink')?.toString().trim() || '',
-    category: formData.get('category')?.toString().trim() || '',
+    pricing: readCoursePricing(formData),
+    enrollmentOpen: formData.get('enrollmentOpen') === 'on',
+    capacity: formData.get('capacity')?.toString().trim() ? Number(formData.get('capacity')) : null,
+    category: '',
+    categoryId: formData.get('category')?.toString().trim() || '',
     tags: formData.get('tags')?.toString().split('\n').map(t => t.trim()).filter(t => t) || [],
     image: formData.get('image')?.toString().trim() || '/images/service-1.png',
   };
@@ -312,7 +344,16 @@ const editCourse = (course: api.Course) => {
   (courseForm.elements.namedItem('lessons') as HTMLInputElement).value = course.lessons;
   (courseForm.elements.namedItem('duration') as HTMLInputElement).value = course.duration;
   (courseForm.elements.namedItem('enrollLink') as HTMLInputElement).value = course.enrollLink || '';
-  (courseForm.elements.namedItem('category') as HTMLSelectElement).value = course.category;
+  const pricing = course.pricing;
+  (courseForm.elements.namedItem('priceFree') as HTMLInputElement).checked = !!pricing?.free;
+  (courseForm.elements.namedItem('priceAmount') as HTMLInputElement).value = pricing && !pricing.free ? fromMinor(pricing.amount) : '';
+  (courseForm.elements.namedItem('priceCurrency') as HTMLSelectElement).value = pricing?.currency || 'UAH';
+  (courseForm.elements.namedItem('discountAmount') as HTMLInputElement).value = fromMinor(pricing?.discount?.amount);
+  (courseForm.elements.namedItem('discountStartsAt') as HTMLInputElement).value = toLocalInput(pricing?.discount?.startsAt);
+  (courseForm.elements.namedItem('discountEndsAt') as HTMLInputElement).value = toLocalInput(pricing?.discount?.endsAt);
+  (courseForm.elements.namedItem('enrollmentOpen') as HTMLInputElement).checked = !!course.enrollmentOpen;
+  (courseForm.elements.namedItem('capacity') as HTMLInputElement).value = course.capacity ? String(course.capacity) : '';
+  (courseForm.elements.namedItem('category') as HTMLSelectElement).value = course.categoryId || '';
   (courseForm.elements.namedItem('tags') as HTMLTextAreaElement).value = course.tags?.join('\n') || '';
   if (courseImageUrl) courseImageUrl.value = course.image;
   if (course.image && courseImagePreview && courseUploadPlaceholder) {
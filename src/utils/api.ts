@@ -21,6 +21,25 @@ export interface VerifyTokenResponse {
   error?: string;
 }
 
+/** Error body returned by the backend for every failed request */
+export interface ApiErrorBody {
+  error: {
+    code: string;
+    message: string;
+    details?: Record<string, string>;
+    requestId?: string;
+  };
+}
+
+/** Locales content can be translated into */
+export type Locale = 'en' | 'uk';
+
+// Content requests ask for one locale explicitly; without one the backend's default
+// locale is returned rather than whatever the browser prefers.
+function localeInit(lang?: Locale): RequestInit {
+  return { headers: { 'Accept-Language': lang || '*' } };
+}
+
 export interface AuthResponse {
   success: boolean;
   message: string;
@@ -42,10 +61,10 @@ export async function verifyToken(idToken: string): Promise<VerifyTokenResponse>
     });
 
     if (!response.ok) {
-      const error = await response.json();
+      const error: ApiErrorBody = await response.json();
       return {
         valid: false,
-        error: error.error || 'Failed to verify token',
+        error: error.error?.message || 'Failed to verify token',
       };
     }
 
@@ -96,10 +115,10 @@ export async function refreshToken(idToken: string): Promise<AuthResponse> {
     });
 
     if (!response.ok) {
-      const error = await response.json();
+      const error: ApiErrorBody = await response.json();
       return {
         success: false,
-        message: error.error || 'Failed to refresh token',
+        message: error.error?.message || 'Failed to refresh token',
       };
     }
 
@@ -128,29 +147,104 @@ export async function healthCheck(): Promise<{ status: string; service: string;
   }
 }
 
+// Resized variants of an image uploaded to the media library
+export interface ImageSet {
+  srcset: string;
+  srcsetWebp: string;
+  thumbnail?: string;
+  width?: number;
+  height?: number;
+}
+
 // Article types and functions
+export type ArticleStatus = 'draft' | 'scheduled' | 'published' | 'archived';
+
+/** Category embedded in articles and courses */
+export interface CategoryRef {
+  id: string;
+  name: string;
+  type: 'blog' | 'course';
+}
+
 export interface Article {
   id?: string;
+  slug?: string;
   title: string;
   excerpt: string;
   content: string;
   author: string;
   date: string;
   category: string;
+  categoryId?: string;
+  categoryRef?: CategoryRef;
   featured: boolean;
   image: string;
+  imageSet?: ImageSet;
+  status?: ArticleStatus;
+  publishAt?: string | null;
   createdAt?: string;
   updatedAt?: string;
+  // Present when fetched with ?render=html
+  contentHtml?: string;
+  toc?: { level: number; text: string; id: string }[];
+  wordCount?: number;
+  readingTime?: number;
+}
+
+export interface ArticlePage {
+  items: Article[];
+  total: number;
+  page?: number;
+  limit: number;
+  nextCursor?: string;
 }
 
-export async function getArticles(): Promise<Article[]> {
-  const response = await fetch(`${API_BASE_URL}/articles`);
+export interface ArticleQuery {
+  page?: number;
+  limit?: number;
+  after?: string;
+  category?: string;
+  categoryId?: string;
+  author?: string;
+  featured?: boolean;
+  sort?: 'date' | 'title' | 'updated';
+  includeContent?: boolean;
+  lang?: Locale;
+}
+
+export async function getArticlesPage(query: ArticleQuery = {}): Promise<ArticlePage> {
+  const params = new URLSearchParams();
+  if (query.page) params.set('page', String(query.page));
+  if (query.limit) params.set('limit', String(query.limit));
+  if (query.after) params.set('after', query.after);
+  if (query.category) params.set('category', query.category);
+  if (query.categoryId) params.set('categoryId', query.categoryId);
+  if (query.author) params.set('author', query.author);
+  if (query.featured !== undefined) params.set('featured', String(query.featured));
+  if (query.sort) params.set('sort', query.sort);
+  if (query.includeContent) params.set('include', 'content');
+
+  const response = await fetch(`${API_BASE_URL}/articles?${params}`, localeInit(query.lang));
   if (!response.ok) throw new Error('Failed to fetch articles');
-  return await response.json();
+  // The body is the array of articles; totals and the next cursor come in headers
+  const items: Article[] = await response.json();
+  const limit = query.limit ?? 20;
+  return {
+    items,
+    total: Number(response.headers.get('X-Total-Count') ?? items.length),
+    page: query.after ? undefined : query.page ?? 1,
+    limit,
+    nextCursor: response.headers.get('X-Next-Cursor') ?? undefined,
+  };
 }
 
-export async function getArticle(id: string): Promise<Article> {
-  const response = await fetch(`${API_BASE_URL}/articles/${id}`);
+export async function getArticles(lang?: Locale): Promise<Article[]> {
+  const page = await getArticlesPage({ limit: 100, includeContent: true, lang });
+  return page.items;
+}
+
+export async function getArticle(id: string, lang?: Locale): Promise<Article> {
+  const response = await fetch(`${API_BASE_URL}/articles/${id}`, localeInit(lang));
   if (!response.ok) {
     if (response.status === 404) throw new Error('Article not found');
     throw new Error('Failed to fetch article');
@@ -188,6 +282,26 @@ export async function deleteArticle(id: string, idToken: string): Promise<void>
 }
 
 // Course types and functions
+
+/** Amounts are in minor units of the currency (4900 USD is $49.00) */
+export interface CoursePricing {
+  free: boolean;
+  amount: number;
+  currency: string;
+  discount?: {
+    amount: number;
+    startsAt?: string;
+    endsAt?: string;
+  };
+  /** Amount to pay now, discount included (read only) */
+  current?: number;
+  discountActive?: boolean;
+  /** Price formatted for the response locale, e.g. "$49.00" or "1 200,00 ₴" (read only) */
+  formatted?: string;
+  /** Price before the active discount (read only) */
+  formattedRegular?: string;
+}
+
 export interface Course {
   id?: string;
   title: string;
@@ -195,19 +309,65 @@ export interface Course {
   lessons: string;
   duration: string;
   enrollLink: string;
+  /** null when the course shows no price */
+  pricing?: CoursePricing | null;
+  /** Visitors can enroll on this site */
+  enrollmentOpen?: boolean;
+  /** Enrollment limit; null means no limit */
+  capacity?: number | null;
+  spotsLeft?: number;
+  /** Totals of the course's lessons; lessons and duration show them once there are any */
+  lessonCount?: number;
+  totalMinutes?: number;
+  /** Only on getCourse */
+  modules?: CourseModule[];
   category: string;
+  categoryId?: string;
+  categoryRef?: CategoryRef;
   tags: string[];
   image: string;
+  imageSet?: ImageSet;
   createdAt?: string;
   updatedAt?: string;
 }
 
-export async function getCourses(): Promise<Course[]> {
-  const response = await fetch(`${API_BASE_URL}/courses`);
+export async function getCourses(lang?: Locale): Promise<Course[]> {
+  const response = await fetch(`${API_BASE_URL}/courses`, localeInit(lang));
   if (!response.ok) throw new Error('Failed to fetch courses');
   return await response.json();
 }
 
+export interface EnrollmentRequest {
+  name: string;
+  email: string;
+  phone?: string;
+  website?: string; // Honeypot
+  createdAt: number;
+}
+
+export interface EnrollmentResult {
+  status: 'enrolled' | 'waitlisted';
+  /** Place on the waitlist */
+  position?: number;
+}
+
+export async function enrollInCourse(courseId: string, data: EnrollmentRequest, lang?: Locale): Promise<EnrollmentResult> {
+  const response = await fetch(`${API_BASE_URL}/courses/${courseId}/enroll`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      'Accept-Language': lang || '*',
+    },
+    body: JSON.stringify(data),
+  });
+
+  if (!response.ok) {
+    const error: ApiErrorBody = await response.json().catch(() => ({}));
+    throw new Error(error.error?.message || 'Failed to enroll');
+  }
+  return await response.json();
+}
+
 export async function saveCourse(course: Course, idToken: string): Promise<Course> {
   const method = course.id ? 'PUT' : 'POST';
   const url = course.id ? `${API_BASE_URL}/courses/${course.id}` : `${API_BASE_URL}/courses`;
@@ -237,16 +397,129 @@ export async function deleteCourse(id: string, idToken: string): Promise<void> {
   if (!response.ok) throw new Error('Failed to delete course');
 }
 
+export interface CourseLesson {
+  id?: string;
+  moduleId?: string;
+  title: string;
+  durationMinutes: number;
+  /** Open to visitors who have not enrolled */
+  preview: boolean;
+  sortOrder?: number;
+}
+
+export interface CourseModule {
+  id?: string;
+  courseId?: string;
+  title: string;
+  sortOrder?: number;
+  lessonCount?: number;
+  totalMinutes?: number;
+  lessons?: CourseLesson[];
+}
+
+export async function getCourse(id: string, lang?: Locale): Promise<Course> {
+  const response = await fetch(`${API_BASE_URL}/courses/${id}`, localeInit(lang));
+  if (!response.ok) throw new Error('Failed to fetch course');
+  return await response.json();
+}
+
+export async function saveCourseModule(courseId: string, module: CourseModule, idToken: string): Promise<CourseModule | void> {
+  const method = module.id ? 'PUT' : 'POST';
+  const url = module.id ? `${API_BASE_URL}/courses/${courseId}/modules/${module.id}` : `${API_BASE_URL}/courses/${courseId}/modules`;
+
+  const response = await fetch(url, {
+    method,
+    headers: {
+      'Content-Type': 'application/json',
+      'Authorization': `Bearer ${idToken}`,
+    },
+    body: JSON.stringify({ title: module.title }),
+  });
+
+  if (!response.ok) throw new Error('Failed to save module');
+  if (method === 'POST') return await response.json();
+}
+
+export async function deleteCourseModule(courseId: string, moduleId: string, idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/courses/${courseId}/modules/${moduleId}`, {
+    method: 'DELETE',
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to delete module');
+}
+
+export async function reorderCourseModules(courseId: string, moduleIds: string[], idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/courses/${courseId}/modules/reorder`, {
+    method: 'PUT',
+    headers: {
+      'Content-Type': 'application/json',
+      'Authorization': `Bearer ${idToken}`,
+    },
+    body: JSON.stringify(moduleIds),
+  });
+
+  if (!response.ok) throw new Error('Failed to reorder modules');
+}
+
+/** Creates a lesson in moduleId, or saves an existing one (moving it when its moduleId changed) */
+export async function saveCourseLesson(courseId: string, moduleId: string, lesson: CourseLesson, idToken: string): Promise<CourseLesson | void> {
+  const method = lesson.id ? 'PUT' : 'POST';
+  const url = lesson.id
+    ? `${API_BASE_URL}/courses/${courseId}/lessons/${lesson.id}`
+    : `${API_BASE_URL}/courses/${courseId}/modules/${moduleId}/lessons`;
+
+  const response = await fetch(url, {
+    method,
+    headers: {
+      'Content-Type': 'application/json',
+      'Authorization': `Bearer ${idToken}`,
+    },
+    body: JSON.stringify({ ...lesson, moduleId: lesson.moduleId || moduleId }),
+  });
+
+  if (!response.ok) throw new Error('Failed to save lesson');
+  if (method === 'POST') return await response.json();
+}
+
+export async function deleteCourseLesson(courseId: string, lessonId: string, idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/courses/${courseId}/lessons/${lessonId}`, {
+    method: 'DELETE',
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to delete lesson');
+}
+
+export async function reorderCourseLessons(courseId: string, moduleId: string, lessonIds: string[], idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/courses/${courseId}/modules/${moduleId}/lessons/reorder`, {
+    method: 'PUT',
+    headers: {
+      'Content-Type': 'application/json',
+      'Authorization': `Bearer ${idToken}`,
+    },
+    body: JSON.stringify(lessonIds),
+  });
+
+  if (!response.ok) throw new Error('Failed to reorder lessons');
+}
+
 // Category types and functions
 export interface Category {
   id?: string;
   name: string;
   type: 'blog' | 'course';
   sort_order?: number;
+  /** Published articles or courses filed under the category */
+  count?: number;
 }
 
-export async function getCategories(): Promise<Category[]> {
-  const response = await fetch(`${API_BASE_URL}/categories`);
+export async function getCategories(lang?: Locale): Promise<Category[]> {
+  const response = await fetch(`${API_BASE_URL}/categories`, localeInit(lang));
   if (!response.ok) throw new Error('Failed to fetch categories');
   return await response.json();
 }
@@ -282,8 +555,13 @@ export async function saveCategory(category: Category, idToken: string): Promise
   return await response.json();
 }
 
-export async function deleteCategory(id: string, idToken: string): Promise<void> {
-  const response = await fetch(`${API_BASE_URL}/categories/${id}`, {
+/**
+ * Delete a category. Categories that are still in use can only be deleted by moving
+ * their content to another category of the same type with reassignTo.
+ */
+export async function deleteCategory(id: string, idToken: string, reassignTo?: string): Promise<void> {
+  const query = reassignTo ? `?reassignTo=${encodeURIComponent(reassignTo)}` : '';
+  const response = await fetch(`${API_BASE_URL}/categories/${id}${query}`, {
     method: 'DELETE',
     headers: {
       'Authorization': `Bearer ${idToken}`,
@@ -302,13 +580,14 @@ export interface Project {
   linkLabel: string;
   linkHref: string;
   image: string;
+  imageSet?: ImageSet;
   sort_order?: number;
   createdAt?: string;
   updatedAt?: string;
 }
 
-export async function getProjects(): Promise<Project[]> {
-  const response = await fetch(`${API_BASE_URL}/projects`);
+export async function getProjects(lang?: Locale): Promise<Project[]> {
+  const response = await fetch(`${API_BASE_URL}/projects`, localeInit(lang));
   if (!response.ok) throw new Error('Failed to fetch projects');
   return await response.json();
 }
@@ -362,13 +641,14 @@ export interface Certificate {
   issuer: string;
   year: string;
   image: string;
+  imageSet?: ImageSet;
   sort_order?: number;
   createdAt?: string;
   updatedAt?: string;
 }
 
-export async function getCertificates(): Promise<Certificate[]> {
-  const response = await fetch(`${API_BASE_URL}/certificates`);
+export async function getCertificates(lang?: Locale): Promise<Certificate[]> {
+  const response = await fetch(`${API_BASE_URL}/certificates`, localeInit(lang));
   if (!response.ok) throw new Error('Failed to fetch certificates');
   return await response.json();
 }
@@ -415,10 +695,270 @@ export async function reorderCertificates(certIDs: string[], idToken: string): P
   if (!response.ok) throw new Error('Failed to reorder certificates');
 }
 
+// Translations (admin)
+export type TranslationType = 'article' | 'course' | 'project' | 'certificate' | 'category';
 
+export interface Translation {
+  locale: Locale;
+  default: boolean;
+  fields: Record<string, string | string[]>;
+  /** Fields with text in the default locale but no translation */
+  missing: string[];
+  updatedAt?: string;
+}
 
+export interface ItemTranslations {
+  type: TranslationType;
+  id: string;
+  defaultLocale: Locale;
+  translations: Translation[];
+}
 
+export interface MissingTranslation {
+  type: TranslationType;
+  id: string;
+  title: string;
+  locale: Locale;
+  missing: string[];
+}
+
+export async function getTranslations(type: TranslationType, id: string, idToken: string): Promise<ItemTranslations> {
+  const response = await fetch(`${API_BASE_URL}/admin/translations/${type}/${id}`, {
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to fetch translations');
+  return await response.json();
+}
+
+export async function saveTranslation(
+  type: TranslationType,
+  id: string,
+  locale: Locale,
+  fields: Record<string, string | string[]>,
+  idToken: string,
+): Promise<Translation> {
+  const response = await fetch(`${API_BASE_URL}/admin/translations/${type}/${id}/${locale}`, {
+    method: 'PUT',
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify(fields),
+  });
+
+  if (!response.ok) throw new Error('Failed to save translation');
+  return await response.json();
+}
+
+export async function deleteTranslation(type: TranslationType, id: string, locale: Locale, idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/admin/translations/${type}/${id}/${locale}`, {
+    method: 'DELETE',
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to delete translation');
+}
+
+export async function getMissingTranslations(
+  idToken: string,
+  filter: { type?: TranslationType; locale?: Locale } = {},
+): Promise<{ items: MissingTranslation[]; summary: Record<string, Record<string, number>> }> {
+  const params = new URLSearchParams();
+  if (filter.type) params.set('type', filter.type);
+  if (filter.locale) params.set('locale', filter.locale);
+
+  const response = await fetch(`${API_BASE_URL}/admin/translations/missing?${params}`, {
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to fetch missing translations');
+  return await response.json();
+}
+
+// Enrollments (admin)
+export type EnrollmentStatus = 'enrolled' | 'waitlisted' | 'cancelled';
+
+export interface Enrollment {
+  id: string;
+  courseId: string;
+  name: string;
+  email: string;
+  phone: string;
+  locale: Locale;
+  status: EnrollmentStatus;
+  position?: number;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface CourseEnrollments {
+  courseId: string;
+  title: string;
+  capacity: number | null;
+  spotsLeft?: number;
+  counts: Record<EnrollmentStatus, number>;
+  items: Enrollment[];
+}
+
+export async function getEnrollments(courseId: string, idToken: string, status?: EnrollmentStatus): Promise<CourseEnrollments> {
+  const params = new URLSearchParams();
+  if (status) params.set('status', status);
+
+  const response = await fetch(`${API_BASE_URL}/admin/courses/${courseId}/enrollments?${params}`, {
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to fetch enrollments');
+  return await response.json();
+}
+
+/** Enrollments as a CSV file */
+export async function exportEnrollments(courseId: string, idToken: string, status?: EnrollmentStatus): Promise<Blob> {
+  const params = new URLSearchParams();
+  if (status) params.set('status', status);
+
+  const response = await fetch(`${API_BASE_URL}/admin/courses/${courseId}/enrollments/export?${params}`, {
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to export enrollments');
+  return await response.blob();
+}
+
+export async function cancelEnrollment(courseId: string, enrollmentId: string, idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/admin/courses/${courseId}/enrollments/${enrollmentId}`, {
+    method: 'DELETE',
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to cancel enrollment');
+}
 
+// Contact inbox (admin)
+export type MessageStatus = 'unread' | 'read' | 'archived' | 'spam';
 
+export interface ContactMessage {
+  id: string;
+  name: string;
+  email: string;
+  subject: string;
+  message: string;
+  status: MessageStatus;
+  /** null while the notification email has not gone out */
+  deliveredAt: string | null;
+  deliveryError?: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface MessagePage {
+  items: ContactMessage[];
+  total: number;
+  page: number;
+  limit: number;
+  counts: Record<MessageStatus, number>;
+}
+
+export async function getMessages(
+  idToken: string,
+  query: { status?: MessageStatus | 'all'; q?: string; page?: number; limit?: number } = {},
+): Promise<MessagePage> {
+  const params = new URLSearchParams();
+  if (query.status) params.set('status', query.status);
+  if (query.q) params.set('q', query.q);
+  if (query.page) params.set('page', String(query.page));
+  if (query.limit) params.set('limit', String(query.limit));
+
+  const response = await fetch(`${API_BASE_URL}/admin/messages?${params}`, {
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
 
+  if (!response.ok) throw new Error('Failed to fetch messages');
+  return await response.json();
+}
 
+export async function setMessageStatus(id: string, status: MessageStatus, idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/admin/messages/${id}`, {
+    method: 'PUT',
+    headers: {
+      'Content-Type': 'application/json',
+      'Authorization': `Bearer ${idToken}`,
+    },
+    body: JSON.stringify({ status }),
+  });
+
+  if (!response.ok) throw new Error('Failed to update message');
+}
+
+// Outgoing email (admin)
+export type EmailStatus = 'pending' | 'sending' | 'sent' | 'dead';
+
+export interface OutboxEmail {
+  id: string;
+  to: string;
+  subject: string;
+  /** plain-text body */
+  body: string;
+  htmlBody?: string;
+  replyTo?: string;
+  status: EmailStatus;
+  attempts: number;
+  nextAttemptAt: string;
+  lastError?: string;
+  sentAt: string | null;
+  contactMessageId?: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface OutboxPage {
+  items: OutboxEmail[];
+  total: number;
+  page: number;
+  limit: number;
+}
+
+export async function getOutbox(
+  idToken: string,
+  query: { status?: EmailStatus; page?: number; limit?: number } = {},
+): Promise<OutboxPage> {
+  const params = new URLSearchParams();
+  if (query.status) params.set('status', query.status);
+  if (query.page) params.set('page', String(query.page));
+  if (query.limit) params.set('limit', String(query.limit));
+
+  const response = await fetch(`${API_BASE_URL}/admin/outbox?${params}`, {
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to fetch outbox');
+  return await response.json();
+}
+
+export async function resendEmail(id: string, idToken: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/admin/outbox/${id}/resend`, {
+    method: 'POST',
+    headers: {
+      'Authorization': `Bearer ${idToken}`,
+    },
+  });
+
+  if (!response.ok) throw new Error('Failed to resend email');
+}